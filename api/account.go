@@ -10,24 +10,29 @@ import (
 
 // Account represents an account on Section
 type Account struct {
-	ID          int    `json:"id"`
-	Href        string `json:"href"`
-	AccountName string `json:"account_name"`
-	IsAdmin     bool   `json:"is_admin"`
-	BillingUser int    `json:"billing_user"`
-	Requires2FA bool   `json:"requires_2fa"`
-	Applications []App `json:"applications"`
+	ID           int    `json:"id"`
+	Href         string `json:"href"`
+	AccountName  string `json:"account_name"`
+	IsAdmin      bool   `json:"is_admin"`
+	BillingUser  int    `json:"billing_user"`
+	Requires2FA  bool   `json:"requires_2fa"`
+	Applications []App  `json:"applications"`
 }
 
 // Accounts returns a list of account the current user has access to.
 func Accounts() (as []Account, err error) {
-	u := BaseURL()
+	return DefaultClient().Accounts(context.Background())
+}
+
+// Accounts returns a list of account the current user has access to.
+func (c *Client) Accounts(ctx context.Context) (as []Account, err error) {
+	u := c.BaseURL()
 	u.Path += "/account/graph"
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return as, err
 	}
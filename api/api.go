@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -22,6 +24,8 @@ var (
 	Timeout = 20 * time.Second
 	// Token is the token for authenticating to the Section API
 	Token string
+	// MaxAttempts caps how many times an idempotent request is sent before giving up
+	MaxAttempts = 3
 
 	// ErrAuthDenied represents all authentication and authorization errors
 	ErrAuthDenied = errors.New("denied")
@@ -32,19 +36,122 @@ var (
 
 	// client is the HTTP client used across requests
 	client http.Client
+
+	// retryBaseDelay is the delay before the first retry, doubled on each subsequent retry
+	retryBaseDelay = 500 * time.Millisecond
+	// retryMaxDelay caps the delay between retries, including delays requested via Retry-After
+	retryMaxDelay = 30 * time.Second
 )
 
+// Client talks to a single Section API endpoint with a single token.
+//
+// A Client is safe for concurrent use, so multiple clients can be used from
+// one process to talk to different endpoints or accounts at the same time.
+type Client struct {
+	// PrefixURI is the root of the Section API
+	PrefixURI *url.URL
+	// Token is the token for authenticating to the Section API
+	Token string
+	// Timeout specifies a time limit for each attempt at a request, so
+	// retries get a full timeout of their own. Zero means no limit beyond
+	// the deadline of the context passed to a call.
+	Timeout time.Duration
+	// HTTPClient is the HTTP client used to perform requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// MaxAttempts caps how many times an idempotent request is sent when
+	// the API is rate limiting or temporarily unavailable. Values below 2
+	// disable retries.
+	MaxAttempts int
+}
+
+// NewClient returns a Client for the Section API at prefix, authenticated with token.
+func NewClient(prefix *url.URL, token string) *Client {
+	return &Client{
+		PrefixURI:   prefix,
+		Token:       token,
+		Timeout:     20 * time.Second,
+		HTTPClient:  &http.Client{},
+		MaxAttempts: 3,
+	}
+}
+
+// DefaultClient returns a Client configured from the package level PrefixURI, Token, Timeout, and MaxAttempts.
+func DefaultClient() *Client {
+	return &Client{
+		PrefixURI:   PrefixURI,
+		Token:       Token,
+		Timeout:     Timeout,
+		HTTPClient:  &client,
+		MaxAttempts: MaxAttempts,
+	}
+}
+
 // BaseURL returns a URL for building requests on
 func BaseURL() (u url.URL) {
-	u = *PrefixURI
+	return DefaultClient().BaseURL()
+}
+
+// BaseURL returns a URL for building requests on
+func (c *Client) BaseURL() (u url.URL) {
+	u = *c.PrefixURI
 	u.Path += "/api/v1"
 	return u
 }
 
+type timeoutKey struct{}
+
+// withTimeout derives a context whose requests are bounded by the client's Timeout.
+//
+// The timeout applies to each attempt at a request, so waiting to retry doesn't use it up.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.WithValue(ctx, timeoutKey{}, c.Timeout))
+}
+
+// attemptContext derives the context for one attempt at a request made with ctx, bounded by
+// the timeout set by withTimeout
+func attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout, _ := ctx.Value(timeoutKey{}).(time.Duration); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// cancelOnClose cancels an attempt's context once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// httpClient returns the HTTP client to perform requests with.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
 // request does the heavy lifting of making requests to the Section API.
 //
 // You can pass 0 or more headers, and keys in the later headers will override earlier passed headers.
 func request(ctx context.Context, method string, u url.URL, body io.Reader, headers ...http.Header) (resp *http.Response, err error) {
+	return DefaultClient().request(ctx, method, u, body, headers...)
+}
+
+// request does the heavy lifting of making requests to the Section API.
+//
+// You can pass 0 or more headers, and keys in the later headers will override earlier passed headers.
+//
+// Idempotent requests are retried with jittered exponential backoff when the API
+// responds with 429 or a transient 5xx, up to the client's MaxAttempts. If ctx's
+// deadline would pass before the next attempt, the last response is returned instead.
+func (c *Client) request(ctx context.Context, method string, u url.URL, body io.Reader, headers ...http.Header) (resp *http.Response, err error) {
 	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return resp, err
@@ -60,22 +167,144 @@ func request(ctx context.Context, method string, u url.URL, body io.Reader, head
 		}
 	}
 
-	req.Header.Add("section-token", Token)
+	req.Header.Add("section-token", c.Token)
 
-	log.Debug().Str("Request Method",method).Str("Request URL", req.URL.String()).Msg("Making Request")
+	log.Debug().Str("Request Method", method).Str("Request URL", req.URL.String()).Msg("Making Request")
 	for k, vs := range req.Header {
 		for _, v := range vs {
 			if k == "Section-Token" {
 				v = "********TOKEN HIDDEN********"
 			}
-			log.Debug().Str(k,v).Msg("Header")
+			log.Debug().Str(k, v).Msg("Header")
+		}
+	}
+
+	attempts := c.MaxAttempts
+	if attempts < 1 || !retryable(req) {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		actx, cancel := attemptContext(ctx)
+		resp, err = c.httpClient().Do(req.WithContext(actx))
+		if err != nil {
+			cancel()
+		} else {
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		}
+		if attempt >= attempts || !shouldRetry(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := retryDelay(attempt, resp)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			log.Debug().Dur("Wait", wait).Time("Deadline", deadline).Msg("Not retrying request to the Section API, as the deadline would pass first")
+			return resp, err
+		}
+		var txID string
+		if resp != nil {
+			txID = resp.Header.Get("Aperture-Tx-Id")
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		ev := log.Warn().Str("Aperture-Tx-Id", txID).Int("Attempt", attempt).Int("Max Attempts", attempts).Dur("Wait", wait)
+		if err != nil {
+			ev = ev.Err(err)
+		} else {
+			ev = ev.Int("Status", resp.StatusCode)
 		}
+		ev.Msg("Retrying request to the Section API")
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+type idempotentKey struct{}
+
+// idempotent marks requests made with ctx as safe to retry, for non-GET
+// requests that don't change state, such as GraphQL queries.
+func idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// retryable reports whether req can safely be sent more than once.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
 	}
-	resp, err = client.Do(req)
+	ok, _ := req.Context().Value(idempotentKey{}).(bool)
+	return ok
+}
+
+// shouldRetry reports whether a request that returned resp and err is worth trying again.
+//
+// An attempt that ran out of time is retried, as each attempt has a timeout of its own. Once
+// the request's context is done, request stops before asking.
+func shouldRetry(resp *http.Response, err error) bool {
 	if err != nil {
-		return resp, err
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before the next attempt, preferring the
+// server's Retry-After header over jittered exponential backoff.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if d > retryMaxDelay {
+				d = retryMaxDelay
+			}
+			return d
+		}
+	}
+	backoff := retryBaseDelay << uint(attempt-1)
+	if backoff <= 0 || backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+	// equal jitter: half fixed, half random
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header value, either in delay-seconds or HTTP-date form.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
 	}
-	return resp, err
+	return 0, false
 }
 
 // prettyTxIDError creates a support friendly error message with an transaction ID
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -183,3 +185,302 @@ func TestAPIrequestReturnsErrorsOnTimeouts(t *testing.T) {
 	assert.Error(err)
 	assert.Regexp("context deadline exceeded", err)
 }
+
+func TestAPIClientsAreIndependent(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal("token-"+name, r.Header.Get("section-token"))
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"id": 1, "email": "%s@example.com"}`, name)
+		}))
+	}
+	tsA := newServer("a")
+	defer tsA.Close()
+	tsB := newServer("b")
+	defer tsB.Close()
+
+	ua, err := url.Parse(tsA.URL)
+	assert.NoError(err)
+	ub, err := url.Parse(tsB.URL)
+	assert.NoError(err)
+
+	ca := NewClient(ua, "token-a")
+	cb := NewClient(ub, "token-b")
+
+	// Invoke
+	userA, errA := ca.CurrentUser(context.Background())
+	userB, errB := cb.CurrentUser(context.Background())
+
+	// Test
+	assert.NoError(errA)
+	assert.NoError(errB)
+	assert.Equal("a@example.com", userA.Email)
+	assert.Equal("b@example.com", userB.Email)
+}
+
+func TestAPIClientHonoursContextCancellation(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1 * time.Second)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Invoke
+	_, err = c.Accounts(ctx)
+
+	// Test
+	assert.Error(err)
+	assert.Regexp("context canceled", err)
+}
+
+func TestAPIrequestRetriesTransientFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 500 * time.Millisecond }()
+
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Add("Aperture-Tx-Id", "12345")
+		switch calls {
+		case 1:
+			w.Header().Add("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	// Invoke
+	resp, err := c.request(context.Background(), http.MethodGet, *u, nil)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(3, calls)
+}
+
+func TestAPIrequestStopsRetryingAfterMaxAttempts(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 500 * time.Millisecond }()
+
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+	c.MaxAttempts = 2
+
+	// Invoke
+	resp, err := c.request(context.Background(), http.MethodGet, *u, nil)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(2, calls)
+}
+
+func TestAPIrequestRetriesIdempotentPostsWithBody(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 500 * time.Millisecond }()
+
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err)
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	// Invoke
+	_, err = c.request(idempotent(context.Background()), http.MethodPost, *u, bytes.NewBufferString(`{"query":"q"}`))
+
+	// Test
+	assert.NoError(err)
+	assert.Equal([]string{`{"query":"q"}`, `{"query":"q"}`}, bodies)
+}
+
+func TestAPIrequestDoesNotRetryNonIdempotentRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	// Invoke
+	resp, err := c.request(context.Background(), http.MethodPost, *u, bytes.NewBufferString("{}"))
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(1, calls)
+}
+
+func TestAPIParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		value string
+		ok    bool
+		wait  time.Duration
+	}{
+		{"", false, 0},
+		{"5", true, 5 * time.Second},
+		{"-1", false, 0},
+		{"soon", false, 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), true, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			// Invoke
+			d, ok := parseRetryAfter(tc.value)
+
+			// Test
+			assert.Equal(tc.ok, ok)
+			assert.Equal(tc.wait, d)
+		})
+	}
+}
+
+func TestAPIrequestReturnsRateLimitWhenRetryAfterOutlastsDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Add("Aperture-Tx-Id", "12345")
+		w.Header().Add("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Invoke
+	start := time.Now()
+	_, err = c.CurrentUser(ctx)
+
+	// Test
+	assert.Error(err)
+	assert.Regexp("status 429 and Section Transaction ID 12345", err)
+	assert.Equal(1, calls)
+	assert.True(time.Since(start) < time.Second, "doesn't wait for a retry that can't happen")
+}
+
+func TestAPIrequestAppliesTimeoutToEachAttempt(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		time.Sleep(150 * time.Millisecond)
+		if calls == 1 {
+			w.Header().Add("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id": 1, "email": "a@example.com"}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+	c.Timeout = 250 * time.Millisecond
+
+	// Invoke
+	user, err := c.CurrentUser(context.Background())
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("a@example.com", user.Email)
+	assert.Equal(2, calls)
+}
+
+func TestAPIrequestRetriesAttemptsThatTimeOut(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = 500 * time.Millisecond }()
+
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			time.Sleep(300 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{"id": 1, "email": "a@example.com"}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+	c.Timeout = 100 * time.Millisecond
+
+	// Invoke
+	user, err := c.CurrentUser(context.Background())
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("a@example.com", user.Email)
+	assert.Equal(2, calls)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -64,13 +65,19 @@ type AppLogs struct {
 
 // Application returns detailed information about a given application.
 func Application(accountID int, applicationID int) (a App, err error) {
-	u := BaseURL()
+	return DefaultClient().Application(context.Background(), accountID, applicationID)
+}
+
+// Application returns detailed information about a given application.
+func (c *Client) Application(ctx context.Context, accountID int, applicationID int) (a App, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/%d", accountID, applicationID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	// the environments and stacks are looked up with ctx, so each request gets a timeout of its own
+	rctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(rctx, http.MethodGet, u, nil)
 	if err != nil {
 		return a, err
 	}
@@ -97,14 +104,14 @@ func Application(accountID int, applicationID int) (a App, err error) {
 		return a, err
 	}
 
-	envs, err := ApplicationEnvironments(accountID, applicationID)
+	envs, err := c.ApplicationEnvironments(ctx, accountID, applicationID)
 	if err != nil {
 		return a, err
 	}
 	a.Environments = envs
 
 	for i, e := range a.Environments {
-		stack, err := ApplicationEnvironmentStack(accountID, applicationID, e.EnvironmentName)
+		stack, err := c.ApplicationEnvironmentStack(ctx, accountID, applicationID, e.EnvironmentName)
 		if err != nil {
 			return a, err
 		}
@@ -116,13 +123,18 @@ func Application(accountID int, applicationID int) (a App, err error) {
 
 // ApplicationEnvironments returns environment information for a given application.
 func ApplicationEnvironments(accountID int, applicationID int) (es []Environment, err error) {
-	u := BaseURL()
+	return DefaultClient().ApplicationEnvironments(context.Background(), accountID, applicationID)
+}
+
+// ApplicationEnvironments returns environment information for a given application.
+func (c *Client) ApplicationEnvironments(ctx context.Context, accountID int, applicationID int) (es []Environment, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/%d/environment", accountID, applicationID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return es, err
 	}
@@ -153,13 +165,18 @@ func ApplicationEnvironments(accountID int, applicationID int) (es []Environment
 
 // ApplicationEnvironmentStack returns the stack for a given application and environment.
 func ApplicationEnvironmentStack(accountID int, applicationID int, environmentName string) (s []Module, err error) {
-	u := BaseURL()
+	return DefaultClient().ApplicationEnvironmentStack(context.Background(), accountID, applicationID, environmentName)
+}
+
+// ApplicationEnvironmentStack returns the stack for a given application and environment.
+func (c *Client) ApplicationEnvironmentStack(ctx context.Context, accountID int, applicationID int, environmentName string) (s []Module, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/%d/environment/%s/stack", accountID, applicationID, environmentName)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return s, err
 	}
@@ -190,13 +207,18 @@ func ApplicationEnvironmentStack(accountID int, applicationID int, environmentNa
 
 // Applications returns a list of applications on a given account.
 func Applications(accountID int) (as []App, err error) {
-	u := BaseURL()
+	return DefaultClient().Applications(context.Background(), accountID)
+}
+
+// Applications returns a list of applications on a given account.
+func (c *Client) Applications(ctx context.Context, accountID int) (as []App, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application", accountID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return as, err
 	}
@@ -233,7 +255,12 @@ type EnvironmentUpdateCommand struct {
 
 // ApplicationEnvironmentModuleUpdate updates a module's configuration
 func ApplicationEnvironmentModuleUpdate(accountID int, applicationID int, env string, filePath string, up []EnvironmentUpdateCommand) (err error) {
-	u := BaseURL()
+	return DefaultClient().ApplicationEnvironmentModuleUpdate(context.Background(), accountID, applicationID, env, filePath, up)
+}
+
+// ApplicationEnvironmentModuleUpdate updates a module's configuration
+func (c *Client) ApplicationEnvironmentModuleUpdate(ctx context.Context, accountID int, applicationID int, env string, filePath string, up []EnvironmentUpdateCommand) (err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/%d/environment/%s/update", accountID, applicationID, env)
 
 	b, err := json.Marshal(up)
@@ -242,11 +269,11 @@ func ApplicationEnvironmentModuleUpdate(accountID int, applicationID int, env st
 	}
 	log.Debug().Msg(fmt.Sprintf(" JSON payload: %s\n", b))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute) // because these requests can take a long time to complete on Section's side
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute) // because these requests can take a long time to complete on Section's side
 	defer cancel()
 	headers := map[string][]string{"filepath": {filePath}}
 
-	resp, err := request(ctx, http.MethodPatch, u, bytes.NewBuffer(b), headers)
+	resp, err := c.request(ctx, http.MethodPatch, u, bytes.NewBuffer(b), headers)
 	if err != nil {
 		return fmt.Errorf("failed to execute trigger request: %v", err)
 	}
@@ -267,9 +294,21 @@ func ApplicationEnvironmentModuleUpdate(accountID int, applicationID int, env st
 	return nil
 }
 
+// EnvironmentID returns the environment ID for a given account, application and environment name
+func EnvironmentID(accountID int, applicationID int, environmentName string) (int, error) {
+	return DefaultClient().EnvironmentID(context.Background(), accountID, applicationID, environmentName)
+}
+
+// EnvironmentID returns the environment ID for a given account, application and environment name
+func (c *Client) EnvironmentID(ctx context.Context, accountID int, applicationID int, environmentName string) (int, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	return c.getEnvironmentID(ctx, accountID, applicationID, environmentName)
+}
+
 // getEnvironmentID returns the environment ID for a given account, application and environment name
-func getEnvironmentID(accountID int, applicationID int, environmentName string) (int, error) {
-	envs, err := ApplicationEnvironments(accountID, applicationID)
+func (c *Client) getEnvironmentID(ctx context.Context, accountID int, applicationID int, environmentName string) (int, error) {
+	envs, err := c.ApplicationEnvironments(ctx, accountID, applicationID)
 	if err != nil {
 		return 0, err
 	}
@@ -279,17 +318,25 @@ func getEnvironmentID(accountID int, applicationID int, environmentName string)
 			return e.ID, nil
 		}
 	}
+	for _, e := range envs {
+		if strings.EqualFold(e.EnvironmentName, environmentName) {
+			return e.ID, nil
+		}
+	}
 	return 0, fmt.Errorf("could not find %s environment", environmentName)
 }
 
-// ApplicationStatus returns a module's current status on Section's delivery platform
-func ApplicationStatus(accountID int, applicationID int, moduleName string) (as []AppStatus, err error) {
-	u := BaseURL()
+// ApplicationStatus returns a module's current status in an app environment on Section's delivery platform
+func ApplicationStatus(accountID int, applicationID int, environmentName string, moduleName string) (as []AppStatus, err error) {
+	return DefaultClient().ApplicationStatus(context.Background(), accountID, applicationID, environmentName, moduleName)
+}
+
+// ApplicationStatus returns a module's current status in an app environment on Section's delivery platform
+func (c *Client) ApplicationStatus(ctx context.Context, accountID int, applicationID int, environmentName string, moduleName string) (as []AppStatus, err error) {
+	u := c.BaseURL()
 	u.Path = "/new/authorized/graphql_api/query"
 
-	// Hard coding to Production environment for now.
-	// Can be changed later for multiple environment support on the same application.
-	environmentID, err := getEnvironmentID(accountID, applicationID, "Production")
+	environmentID, err := c.getEnvironmentID(ctx, accountID, applicationID, environmentName)
 	if err != nil {
 		return as, err
 	}
@@ -304,12 +351,12 @@ func ApplicationStatus(accountID int, applicationID int, moduleName string) (as
 		"moduleName":    moduleName,
 		"environmentID": environmentID,
 	}
-	requestData.Query = "query DeploymentStatus($moduleName: String!, $environmentID: Int!){deploymentStatus(moduleName:$moduleName, environmentID:$environmentID){inService state instanceName payloadID}}"
+	requestData.Query = "query DeploymentStatus($moduleName: String!, $environmentID: Int!){deploymentStatus(moduleName:$moduleName, environmentID:$environmentID){inService state instanceName payloadID isLatest}}"
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(idempotent(ctx))
 	defer cancel()
 	data, err := json.Marshal(requestData)
-	resp, err := request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
+	resp, err := c.request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
 	if err != nil {
 		return as, err
 	}
@@ -348,14 +395,17 @@ func ApplicationStatus(accountID int, applicationID int, moduleName string) (as
 	return as, nil
 }
 
-// ApplicationLogs returns a module's logs from Section's delivery platform
-func ApplicationLogs(accountID int, applicationID int, moduleName string, instanceName string, number int, startTimestampRfc3339 string) (al []AppLogs, err error) {
-	u := BaseURL()
+// ApplicationLogs returns a module's logs in an app environment from Section's delivery platform
+func ApplicationLogs(accountID int, applicationID int, environmentName string, moduleName string, instanceName string, number int, startTimestampRfc3339 string) (al []AppLogs, err error) {
+	return DefaultClient().ApplicationLogs(context.Background(), accountID, applicationID, environmentName, moduleName, instanceName, number, startTimestampRfc3339)
+}
+
+// ApplicationLogs returns a module's logs in an app environment from Section's delivery platform
+func (c *Client) ApplicationLogs(ctx context.Context, accountID int, applicationID int, environmentName string, moduleName string, instanceName string, number int, startTimestampRfc3339 string) (al []AppLogs, err error) {
+	u := c.BaseURL()
 	u.Path = "/new/authorized/graphql_api/query"
 
-	// Hard coding to Production environment for now.
-	// Can be changed later for multiple environment support on the same application.
-	environmentID, err := getEnvironmentID(accountID, applicationID, "Production")
+	environmentID, err := c.getEnvironmentID(ctx, accountID, applicationID, environmentName)
 	if err != nil {
 		return al, err
 	}
@@ -384,17 +434,24 @@ func ApplicationLogs(accountID int, applicationID int, moduleName string, instan
 		requestData.Query = "query Logs($moduleName: String!, $environmentId: Int!, $instanceName: String, $length: Int, $startTimestampRfc3339: String){logs(moduleName:$moduleName, environmentId:$environmentId, instanceName:$instanceName, length:$length, startTimestampRfc3339:$startTimestampRfc3339){timestamp instanceName message type}}"
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(idempotent(ctx))
 	defer cancel()
 	data, err := json.Marshal(requestData)
-	resp, err := request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
+	resp, err := c.request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
 	if err != nil {
 		return al, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return al, prettyTxIDError(resp)
+		switch resp.StatusCode {
+		case 401:
+			return al, ErrStatusUnauthorized
+		case 403:
+			return al, ErrStatusForbidden
+		default:
+			return al, prettyTxIDError(resp)
+		}
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -431,7 +488,12 @@ type ApplicationCreateResponse struct {
 
 // ApplicationCreate creates an application on the Section platform.
 func ApplicationCreate(accountID int, hostname, origin, stackName string) (r ApplicationCreateResponse, err error) {
-	u := BaseURL()
+	return DefaultClient().ApplicationCreate(context.Background(), accountID, hostname, origin, stackName)
+}
+
+// ApplicationCreate creates an application on the Section platform.
+func (c *Client) ApplicationCreate(ctx context.Context, accountID int, hostname, origin, stackName string) (r ApplicationCreateResponse, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/create", accountID)
 
 	appCreateReq := struct {
@@ -444,11 +506,11 @@ func ApplicationCreate(accountID int, hostname, origin, stackName string) (r App
 		stackName,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
 	data, err := json.Marshal(appCreateReq)
-	resp, err := request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
+	resp, err := c.request(ctx, http.MethodPost, u, bytes.NewBuffer(data))
 	if err != nil {
 		return r, err
 	}
@@ -516,13 +578,18 @@ type ApplicationDeleteResponse struct {
 
 // ApplicationDelete deletes an application on the Section platform.
 func ApplicationDelete(accountID, appID int) (r ApplicationDeleteResponse, err error) {
-	u := BaseURL()
+	return DefaultClient().ApplicationDelete(context.Background(), accountID, appID)
+}
+
+// ApplicationDelete deletes an application on the Section platform.
+func (c *Client) ApplicationDelete(ctx context.Context, accountID, appID int) (r ApplicationDeleteResponse, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/application/%d", accountID, appID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodDelete, u, nil)
+	resp, err := c.request(ctx, http.MethodDelete, u, nil)
 	if err != nil {
 		return r, fmt.Errorf("unable to perform request: %w", err)
 	}
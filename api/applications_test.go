@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -152,3 +153,52 @@ func TestAPIApplicationDeleteReturnsUniqueErrorsOnFailure(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIApplicationStatusQueriesRequestedEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var testCases = []struct {
+		environment   string
+		environmentID int
+	}{
+		{"Production", 10},
+		{"staging", 20},
+		{"Staging", 20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.environment, func(t *testing.T) {
+			var queried float64
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/account/1/application/2/environment":
+					fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}, {"id": 20, "environment_name": "staging"}]`)
+				case "/new/authorized/graphql_api/query":
+					var req struct {
+						Variables map[string]interface{} `json:"variables"`
+					}
+					b, err := ioutil.ReadAll(r.Body)
+					assert.NoError(err)
+					assert.NoError(json.Unmarshal(b, &req))
+					queried = req.Variables["environmentID"].(float64)
+					fmt.Fprint(w, `{"data": {"deploymentStatus": [{"inService": true, "state": "Running", "instanceName": "nodejs-abc"}]}}`)
+				default:
+					assert.FailNowf("unhandled URL", "URL: %s", r.URL.Path)
+				}
+			}))
+			defer ts.Close()
+			u, err := url.Parse(ts.URL)
+			assert.NoError(err)
+			c := NewClient(u, "s3cr3t")
+
+			// Invoke
+			as, err := c.ApplicationStatus(context.Background(), 1, 2, tc.environment, "nodejs")
+
+			// Test
+			assert.NoError(err)
+			assert.Equal(float64(tc.environmentID), queried)
+			assert.Len(as, 1)
+		})
+	}
+}
@@ -17,13 +17,18 @@ type DomainsResponse struct {
 
 // Domains returns a list of an account's domains
 func Domains(accountID int) (d []DomainsResponse, err error) {
-	u := BaseURL()
+	return DefaultClient().Domains(context.Background(), accountID)
+}
+
+// Domains returns a list of an account's domains
+func (c *Client) Domains(ctx context.Context, accountID int) (d []DomainsResponse, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/domains", accountID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, u, nil)
+	resp, err := c.request(ctx, http.MethodGet, u, nil)
 	if err != nil {
 		return d, err
 	}
@@ -72,13 +77,18 @@ type RenewCertResponse struct {
 
 // DomainsRenewCert handles renewing a certificate for a given account and domain.
 func DomainsRenewCert(accountID int, hostname string) (r RenewCertResponse, err error) {
-	u := BaseURL()
+	return DefaultClient().DomainsRenewCert(context.Background(), accountID, hostname)
+}
+
+// DomainsRenewCert handles renewing a certificate for a given account and domain.
+func (c *Client) DomainsRenewCert(ctx context.Context, accountID int, hostname string) (r RenewCertResponse, err error) {
+	u := c.BaseURL()
 	u.Path += fmt.Sprintf("/account/%d/domain/%s/renewCertificate", accountID, hostname)
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodPost, u, nil)
+	resp, err := c.request(ctx, http.MethodPost, u, nil)
 	if err != nil {
 		return r, err
 	}
@@ -17,13 +17,18 @@ type Stack struct {
 
 // Stacks returns the available deployable stacks
 func Stacks() (s []Stack, err error) {
-	ur := BaseURL()
+	return DefaultClient().Stacks(context.Background())
+}
+
+// Stacks returns the available deployable stacks
+func (c *Client) Stacks(ctx context.Context) (s []Stack, err error) {
+	ur := c.BaseURL()
 	ur.Path += "/stack"
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, ur, nil)
+	resp, err := c.request(ctx, http.MethodGet, ur, nil)
 	if err != nil {
 		return s, err
 	}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/websocket"
+
+	"github.com/section/sectionctl/version"
+)
+
+// ErrSubscriptionsUnsupported is returned when the API does not accept GraphQL subscriptions,
+// so callers can fall back to polling.
+var ErrSubscriptionsUnsupported = errors.New("the Section API does not support subscriptions")
+
+// graphQLMessage is a message in the graphql-ws protocol used for GraphQL subscriptions
+type graphQLMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// SubscribeApplicationLogs streams a module's logs in an app environment as they are written,
+// calling fn for each line until ctx is done, fn returns an error, or the API ends the subscription.
+func SubscribeApplicationLogs(ctx context.Context, accountID int, applicationID int, environmentName string, moduleName string, instanceName string, started func() error, fn func(AppLogs) error) error {
+	return DefaultClient().SubscribeApplicationLogs(ctx, accountID, applicationID, environmentName, moduleName, instanceName, started, fn)
+}
+
+// SubscribeApplicationLogs streams a module's logs in an app environment as they are written,
+// calling fn for each line until ctx is done, fn returns an error, or the API ends the subscription.
+//
+// started, if set, is called once the subscription has started, before any lines are passed to fn,
+// so callers can fetch lines written before then. An error from it ends the subscription.
+//
+// It returns ErrSubscriptionsUnsupported when the API refuses the websocket or the subscription.
+func (c *Client) SubscribeApplicationLogs(ctx context.Context, accountID int, applicationID int, environmentName string, moduleName string, instanceName string, started func() error, fn func(AppLogs) error) error {
+	environmentID, err := c.getEnvironmentID(ctx, accountID, applicationID, environmentName)
+	if err != nil {
+		return err
+	}
+
+	variables := map[string]interface{}{
+		"environmentId": environmentID,
+		"moduleName":    moduleName,
+	}
+	if instanceName != "" {
+		variables["instanceName"] = instanceName
+	}
+	start, err := json.Marshal(map[string]interface{}{
+		"operationName": "Logs",
+		"variables":     variables,
+		"query":         "subscription Logs($moduleName: String!, $environmentId: Int!, $instanceName: String){logs(moduleName:$moduleName, environmentId:$environmentId, instanceName:$instanceName){timestamp instanceName message type}}",
+	})
+	if err != nil {
+		return err
+	}
+
+	ws, err := c.dialSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	// unblock reads when the caller is done with us
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = websocket.JSON.Send(ws, graphQLMessage{ID: "1", Type: "stop"})
+			ws.Close()
+		case <-done:
+		}
+	}()
+
+	auth, _ := json.Marshal(map[string]string{"section-token": c.Token})
+	if err := websocket.JSON.Send(ws, graphQLMessage{Type: "connection_init", Payload: auth}); err != nil {
+		return err
+	}
+
+	subscribed := false
+	for {
+		var msg graphQLMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("log subscription interrupted: %w", err)
+		}
+		log.Debug().Str("Type", msg.Type).RawJSON("Payload", nonEmptyJSON(msg.Payload)).Msg("Subscription message")
+
+		switch msg.Type {
+		case "connection_ack":
+			if subscribed {
+				continue
+			}
+			if err := websocket.JSON.Send(ws, graphQLMessage{ID: "1", Type: "start", Payload: start}); err != nil {
+				return err
+			}
+			subscribed = true
+			if started != nil {
+				if err := started(); err != nil {
+					return err
+				}
+			}
+		case "ka":
+			// keep alive
+		case "data":
+			logs, err := subscriptionLogs(msg.Payload)
+			if err != nil {
+				return err
+			}
+			for _, l := range logs {
+				if err := fn(l); err != nil {
+					return err
+				}
+			}
+		case "connection_error", "error":
+			return fmt.Errorf("%w: %s", ErrSubscriptionsUnsupported, string(msg.Payload))
+		case "complete":
+			return nil
+		}
+	}
+}
+
+// dialSubscriptions opens a websocket to the GraphQL API, which serves subscriptions on the same path as queries.
+//
+// Connecting and the websocket handshake are bounded by the client's Timeout, and abandoned if ctx is done first.
+func (c *Client) dialSubscriptions(ctx context.Context) (*websocket.Conn, error) {
+	u := c.BaseURL()
+	u.Path = "/new/authorized/graphql_api/query"
+	origin := u
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	config, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{"graphql-ws"}
+	config.Header = http.Header{}
+	config.Header.Set("User-Agent", fmt.Sprintf("sectionctl (%s; %s-%s)", version.Version, runtime.GOARCH, runtime.GOOS))
+	config.Header.Set("section-token", c.Token)
+
+	log.Debug().Str("Request URL", u.String()).Msg("Opening subscription")
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), map[string]string{"ws": "80", "wss": "443"}[u.Scheme])
+	}
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	handshook := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshook:
+		}
+	}()
+	ws, err := websocket.NewClient(config, conn)
+	close(handshook)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == websocket.ErrBadStatus {
+			return nil, fmt.Errorf("%w: %s", ErrSubscriptionsUnsupported, err)
+		}
+		return nil, fmt.Errorf("unable to open subscription: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+// subscriptionLogs decodes the logs in a data message, which may carry one line or a batch
+func subscriptionLogs(payload json.RawMessage) (al []AppLogs, err error) {
+	var body struct {
+		Data struct {
+			Logs json.RawMessage `json:"logs"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return al, err
+	}
+	if len(body.Errors) > 0 {
+		return al, fmt.Errorf("%w: %s", ErrSubscriptionsUnsupported, body.Errors[0].Message)
+	}
+	if len(body.Data.Logs) == 0 || string(body.Data.Logs) == "null" {
+		return al, nil
+	}
+	if body.Data.Logs[0] == '[' {
+		err = json.Unmarshal(body.Data.Logs, &al)
+		return al, err
+	}
+	var l AppLogs
+	err = json.Unmarshal(body.Data.Logs, &l)
+	return []AppLogs{l}, err
+}
+
+func nonEmptyJSON(b json.RawMessage) []byte {
+	if len(b) == 0 {
+		return []byte("null")
+	}
+	return b
+}
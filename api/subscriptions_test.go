@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestAPISubscribeApplicationLogsStreamsLines(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var token string
+	var variables map[string]interface{}
+	ws := websocket.Server{Handler: func(ws *websocket.Conn) {
+		var msg graphQLMessage
+		assert.NoError(websocket.JSON.Receive(ws, &msg))
+		assert.Equal("connection_init", msg.Type)
+		var auth map[string]string
+		assert.NoError(json.Unmarshal(msg.Payload, &auth))
+		token = auth["section-token"]
+		assert.NoError(websocket.JSON.Send(ws, graphQLMessage{Type: "connection_ack"}))
+
+		assert.NoError(websocket.JSON.Receive(ws, &msg))
+		assert.Equal("start", msg.Type)
+		var start struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		assert.NoError(json.Unmarshal(msg.Payload, &start))
+		variables = start.Variables
+
+		assert.NoError(websocket.JSON.Send(ws, graphQLMessage{Type: "ka"}))
+		assert.NoError(websocket.JSON.Send(ws, graphQLMessage{ID: "1", Type: "data", Payload: json.RawMessage(`{"data": {"logs": [{"instanceName": "nodejs-a", "message": "one"}, {"instanceName": "nodejs-b", "message": "two"}]}}`)}))
+		assert.NoError(websocket.JSON.Send(ws, graphQLMessage{ID: "1", Type: "data", Payload: json.RawMessage(`{"data": {"logs": {"instanceName": "nodejs-a", "message": "three"}}}`)}))
+		assert.NoError(websocket.JSON.Send(ws, graphQLMessage{ID: "1", Type: "complete"}))
+	}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		case "/new/authorized/graphql_api/query":
+			ws.ServeHTTP(w, r)
+		default:
+			assert.FailNowf("unhandled URL", "URL: %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	// Invoke
+	var messages []string
+	err = c.SubscribeApplicationLogs(context.Background(), 1, 2, "Production", "nodejs", "", nil, func(l AppLogs) error {
+		messages = append(messages, l.Message)
+		return nil
+	})
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("s3cr3t", token)
+	assert.Equal(float64(10), variables["environmentId"])
+	assert.NotContains(variables, "instanceName")
+	assert.Equal([]string{"one", "two", "three"}, messages)
+}
+
+func TestAPISubscribeApplicationLogsReportsUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	c := NewClient(u, "s3cr3t")
+
+	// Invoke
+	err = c.SubscribeApplicationLogs(context.Background(), 1, 2, "Production", "nodejs", "", nil, func(l AppLogs) error { return nil })
+
+	// Test
+	assert.True(errors.Is(err, ErrSubscriptionsUnsupported), "got %v", err)
+}
+
+func TestAPIdialSubscriptionsAbandonsHungHandshake(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		timeout time.Duration
+		cancel  time.Duration
+	}{
+		{"timeout", 100 * time.Millisecond, 0},
+		{"cancelled", 0, 100 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(err)
+			defer l.Close()
+			go func() {
+				// accept connections but never answer the handshake
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+				}
+			}()
+
+			c := NewClient(&url.URL{Scheme: "http", Host: l.Addr().String()}, "s3cr3t")
+			c.Timeout = tc.timeout
+			ctx := context.Background()
+			if tc.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.cancel)
+				defer cancel()
+			}
+
+			// Invoke
+			start := time.Now()
+			_, err = c.dialSubscriptions(ctx)
+
+			// Test
+			assert.Error(err)
+			assert.True(time.Since(start) < 5*time.Second, "gives up on the handshake")
+		})
+	}
+}
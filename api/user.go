@@ -22,13 +22,18 @@ type User struct {
 
 // CurrentUser returns details for the currently authenticated user
 func CurrentUser() (u User, err error) {
-	ur := BaseURL()
+	return DefaultClient().CurrentUser(context.Background())
+}
+
+// CurrentUser returns details for the currently authenticated user
+func (c *Client) CurrentUser(ctx context.Context) (u User, err error) {
+	ur := c.BaseURL()
 	ur.Path += "/user"
 
-	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	ctx, cancel := c.withTimeout(ctx)
 	defer cancel()
 
-	resp, err := request(ctx, http.MethodGet, ur, nil)
+	resp, err := c.request(ctx, http.MethodGet, ur, nil)
 	if err != nil {
 		return u, err
 	}
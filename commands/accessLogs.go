@@ -0,0 +1,267 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/section/sectionctl/api"
+)
+
+// AccessLogEntry is an access log line broken into its fields
+type AccessLogEntry struct {
+	Time     time.Time
+	ClientIP string
+	Method   string
+	Path     string
+	Status   int
+	Latency  time.Duration
+	Bytes    int64
+}
+
+// combinedLogFormat matches the Common and Combined Log Formats, optionally followed by
+// the request time in seconds, as logged by nginx's $request_time.
+var combinedLogFormat = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) (\d+|-)(?: "[^"]*" "[^"]*")?(?: (\d+(?:\.\d+)?))?`)
+
+// ParseAccessLog parses an access log line, in either JSON or the Combined Log Format.
+//
+// It returns false when the line can't be parsed.
+func ParseAccessLog(l api.AppLogs) (e AccessLogEntry, ok bool) {
+	msg := strings.TrimSpace(l.Message)
+	if strings.HasPrefix(msg, "{") {
+		e, ok = parseJSONAccessLog(msg)
+	} else {
+		e, ok = parseCombinedAccessLog(msg)
+	}
+	if !ok {
+		return e, false
+	}
+	if t := logTime(l); !t.IsZero() {
+		e.Time = t
+	}
+	if u, err := url.Parse(e.Path); err == nil && u.Path != "" {
+		e.Path = u.Path
+	}
+	return e, true
+}
+
+func parseCombinedAccessLog(msg string) (e AccessLogEntry, ok bool) {
+	m := combinedLogFormat.FindStringSubmatch(msg)
+	if m == nil {
+		return e, false
+	}
+	e.ClientIP = m[1]
+	e.Time, _ = time.Parse("02/Jan/2006:15:04:05 -0700", m[2])
+	e.Method = m[3]
+	e.Path = m[4]
+	e.Status, _ = strconv.Atoi(m[5])
+	e.Bytes, _ = strconv.ParseInt(m[6], 10, 64)
+	if m[7] != "" {
+		secs, _ := strconv.ParseFloat(m[7], 64)
+		e.Latency = time.Duration(secs * float64(time.Second))
+	}
+	return e, true
+}
+
+func parseJSONAccessLog(msg string) (e AccessLogEntry, ok bool) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &fields); err != nil {
+		return e, false
+	}
+	status, ok := jsonNumber(fields, "status", "status_code", "statusCode")
+	if !ok {
+		return e, false
+	}
+	e.Status = int(status)
+	e.Method = jsonString(fields, "method", "request_method", "requestMethod")
+	e.Path = jsonString(fields, "path", "uri", "request_uri", "requestUri", "url")
+	if request := jsonString(fields, "request"); request != "" && (e.Method == "" || e.Path == "") {
+		// "GET /path HTTP/1.1"
+		parts := strings.Fields(request)
+		if len(parts) >= 2 {
+			e.Method, e.Path = parts[0], parts[1]
+		}
+	}
+	e.ClientIP = jsonString(fields, "remote_addr", "client_ip", "clientIp", "ip")
+	if b, ok := jsonNumber(fields, "bytes", "bytes_sent", "body_bytes_sent", "size"); ok {
+		e.Bytes = int64(b)
+	}
+	if secs, ok := jsonNumber(fields, "request_time", "latency", "duration"); ok {
+		e.Latency = time.Duration(secs * float64(time.Second))
+	} else if ms, ok := jsonNumber(fields, "latency_ms", "duration_ms", "response_time_ms"); ok {
+		e.Latency = time.Duration(ms * float64(time.Millisecond))
+	}
+	if t := jsonString(fields, "time", "timestamp", "time_iso8601"); t != "" {
+		e.Time, _ = time.Parse(time.RFC3339Nano, t)
+	}
+	return e, true
+}
+
+// jsonString returns the first of keys present in fields, as a string
+func jsonString(fields map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := fields[k]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// jsonNumber returns the first of keys present in fields, as a number, accepting numeric strings
+func jsonNumber(fields map[string]interface{}, keys ...string) (float64, bool) {
+	for _, k := range keys {
+		switch v := fields[k].(type) {
+		case float64:
+			return v, true
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// AccessLogSummary aggregates access logs
+type AccessLogSummary struct {
+	Requests int             `json:"requests"`
+	Unparsed int             `json:"unparsed"`
+	Statuses map[string]int  `json:"statuses"`
+	TopPaths []PathCount     `json:"topPaths"`
+	Windows  []LatencyWindow `json:"windows"`
+}
+
+// PathCount is the number of requests for a path
+type PathCount struct {
+	Path     string `json:"path"`
+	Requests int    `json:"requests"`
+}
+
+// LatencyWindow holds latency percentiles for the requests in a window of time
+type LatencyWindow struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+	P50Ms    float64   `json:"p50Ms"`
+	P95Ms    float64   `json:"p95Ms"`
+	P99Ms    float64   `json:"p99Ms"`
+}
+
+// SummarizeAccessLogs parses access logs and aggregates them, with latency percentiles for
+// each window of the given length, and the top most requested paths.
+func SummarizeAccessLogs(logs []api.AppLogs, window time.Duration, top int) AccessLogSummary {
+	s := AccessLogSummary{Statuses: map[string]int{}, TopPaths: []PathCount{}, Windows: []LatencyWindow{}}
+	paths := map[string]int{}
+	latencies := map[time.Time][]time.Duration{}
+	for _, l := range logs {
+		if l.Type != "" && l.Type != "access" {
+			continue
+		}
+		e, ok := ParseAccessLog(l)
+		if !ok {
+			s.Unparsed++
+			continue
+		}
+		s.Requests++
+		s.Statuses[strconv.Itoa(e.Status)]++
+		paths[e.Path]++
+		if e.Latency > 0 && !e.Time.IsZero() {
+			start := e.Time.Truncate(window)
+			latencies[start] = append(latencies[start], e.Latency)
+		}
+	}
+
+	for p, n := range paths {
+		s.TopPaths = append(s.TopPaths, PathCount{Path: p, Requests: n})
+	}
+	sort.Slice(s.TopPaths, func(i, j int) bool {
+		if s.TopPaths[i].Requests != s.TopPaths[j].Requests {
+			return s.TopPaths[i].Requests > s.TopPaths[j].Requests
+		}
+		return s.TopPaths[i].Path < s.TopPaths[j].Path
+	})
+	if top > 0 && len(s.TopPaths) > top {
+		s.TopPaths = s.TopPaths[:top]
+	}
+
+	for start, ls := range latencies {
+		sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+		s.Windows = append(s.Windows, LatencyWindow{
+			Start:    start,
+			Requests: len(ls),
+			P50Ms:    durationMs(percentile(ls, 50)),
+			P95Ms:    durationMs(percentile(ls, 95)),
+			P99Ms:    durationMs(percentile(ls, 99)),
+		})
+	}
+	sort.Slice(s.Windows, func(i, j int) bool { return s.Windows[i].Start.Before(s.Windows[j].Start) })
+	return s
+}
+
+// percentile returns the p-th percentile of sorted, using the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func durationMs(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// printAccessLogSummary renders the summary as tables. They're written even with --quiet, as
+// the summary is what was asked for.
+func printAccessLogSummary(out io.Writer, s AccessLogSummary) {
+	fmt.Fprintf(out, "Requests: %d", s.Requests)
+	if s.Unparsed > 0 {
+		fmt.Fprintf(out, " (%d lines could not be parsed)", s.Unparsed)
+	}
+	fmt.Fprintln(out)
+
+	var codes []string
+	for code := range s.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	table := newTable(out)
+	table.SetHeader([]string{"Status", "Requests", "%"})
+	for _, code := range codes {
+		n := s.Statuses[code]
+		table.Append([]string{code, strconv.Itoa(n), fmt.Sprintf("%.1f", float64(n)*100/float64(s.Requests))})
+	}
+	table.Render()
+
+	table = newTable(out)
+	table.SetHeader([]string{"Path", "Requests"})
+	for _, p := range s.TopPaths {
+		table.Append([]string{p.Path, strconv.Itoa(p.Requests)})
+	}
+	table.Render()
+
+	if len(s.Windows) == 0 {
+		return
+	}
+	table = newTable(out)
+	table.SetHeader([]string{"Window", "Requests", "p50 (ms)", "p95 (ms)", "p99 (ms)"})
+	for _, w := range s.Windows {
+		table.Append([]string{
+			w.Start.Format(time.RFC3339),
+			strconv.Itoa(w.Requests),
+			strconv.FormatFloat(w.P50Ms, 'f', -1, 64),
+			strconv.FormatFloat(w.P95Ms, 'f', -1, 64),
+			strconv.FormatFloat(w.P99Ms, 'f', -1, 64),
+		})
+	}
+	table.Render()
+}
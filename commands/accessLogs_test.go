@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsParseAccessLog(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		message string
+		want    AccessLogEntry
+		ok      bool
+	}{
+		{
+			"combined with request time",
+			`203.0.113.9 - - [01/Jun/2021:10:00:00 +0000] "GET /products?page=2 HTTP/1.1" 200 5120 "-" "curl/7.64.1" 0.123`,
+			AccessLogEntry{ClientIP: "203.0.113.9", Method: "GET", Path: "/products", Status: 200, Bytes: 5120, Latency: 123 * time.Millisecond, Time: time.Date(2021, 6, 1, 10, 0, 0, 0, time.FixedZone("", 0))},
+			true,
+		},
+		{
+			"common",
+			`203.0.113.9 - - [01/Jun/2021:10:00:00 +0000] "POST /login HTTP/1.1" 302 -`,
+			AccessLogEntry{ClientIP: "203.0.113.9", Method: "POST", Path: "/login", Status: 302, Time: time.Date(2021, 6, 1, 10, 0, 0, 0, time.FixedZone("", 0))},
+			true,
+		},
+		{
+			"json",
+			`{"remote_addr": "203.0.113.9", "request": "GET /api/cart HTTP/1.1", "status": "503", "body_bytes_sent": 17, "request_time": "0.5"}`,
+			AccessLogEntry{ClientIP: "203.0.113.9", Method: "GET", Path: "/api/cart", Status: 503, Bytes: 17, Latency: 500 * time.Millisecond},
+			true,
+		},
+		{
+			"json with milliseconds",
+			`{"method": "GET", "path": "/", "status": 200, "latency_ms": 42}`,
+			AccessLogEntry{Method: "GET", Path: "/", Status: 200, Latency: 42 * time.Millisecond},
+			true,
+		},
+		{"app log", `listening on port 8080`, AccessLogEntry{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			got, ok := ParseAccessLog(api.AppLogs{Type: "access", Message: tc.message})
+			assert.Equal(tc.ok, ok)
+			if !tc.ok {
+				return
+			}
+			assert.True(tc.want.Time.Equal(got.Time), "want %s, got %s", tc.want.Time, got.Time)
+			got.Time = tc.want.Time
+			assert.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestCommandsSummarizeAccessLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup: 100 requests in the first minute taking 1..100ms, and one slow request in the second
+	base := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	var logs []api.AppLogs
+	for i := 1; i <= 100; i++ {
+		status, path := 200, "/"
+		if i%10 == 0 {
+			status, path = 500, "/api"
+		}
+		logs = append(logs, api.AppLogs{
+			Timestamp: base.Add(time.Duration(i) * 100 * time.Millisecond).Format(time.RFC3339Nano),
+			Type:      "access",
+			Message:   fmt.Sprintf(`{"method": "GET", "path": "%s", "status": %d, "latency_ms": %d}`, path, status, i),
+		})
+	}
+	logs = append(logs,
+		api.AppLogs{Timestamp: base.Add(90 * time.Second).Format(time.RFC3339), Type: "access", Message: `{"method": "GET", "path": "/slow", "status": 200, "latency_ms": 2000}`},
+		api.AppLogs{Timestamp: base.Format(time.RFC3339), Type: "access", Message: `garbage`},
+		api.AppLogs{Timestamp: base.Format(time.RFC3339), Type: "app", Message: `not an access log`},
+	)
+
+	// Invoke
+	s := SummarizeAccessLogs(logs, time.Minute, 2)
+
+	// Test
+	assert.Equal(101, s.Requests)
+	assert.Equal(1, s.Unparsed)
+	assert.Equal(map[string]int{"200": 91, "500": 10}, s.Statuses)
+	assert.Equal([]PathCount{{"/", 90}, {"/api", 10}}, s.TopPaths)
+	assert.Len(s.Windows, 2)
+	assert.Equal(base, s.Windows[0].Start)
+	assert.Equal(100, s.Windows[0].Requests)
+	assert.Equal(50.0, s.Windows[0].P50Ms)
+	assert.Equal(95.0, s.Windows[0].P95Ms)
+	assert.Equal(99.0, s.Windows[0].P99Ms)
+	assert.Equal(2000.0, s.Windows[1].P99Ms)
+}
@@ -27,6 +27,10 @@ func (c *AccountsListCmd) Run(cli *CLI, ctx *kong.Context,logWriters *LogWriters
 		return err
 	}
 
+	if ok, err := WriteStructured(cli, os.Stdout, accounts); ok {
+		return err
+	}
+
 	table := NewTable(cli, os.Stdout)
 	table.SetHeader([]string{"Account ID", "Account Name"})
 
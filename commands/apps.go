@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -33,6 +34,11 @@ func NewTable(cli *CLI, out io.Writer) (t *tablewriter.Table) {
 	if cli.Quiet {
 		out = io.Discard
 	}
+	return newTable(out)
+}
+
+// newTable returns a table with sectionctl standard formatting, written even with --quiet
+func newTable(out io.Writer) (t *tablewriter.Table) {
 	t = tablewriter.NewWriter(out)
 	t.SetBorders(tablewriter.Border{Left: true, Top: true, Right: true, Bottom: true})
 	t.SetCenterSeparator("|")
@@ -65,6 +71,9 @@ func (c *AppsListCmd) Run(cli *CLI, logWriters *LogWriters) (err error){
 			os.Exit(1)
 		}
 	}
+	if ok, err := WriteStructured(cli, os.Stdout, accounts); ok {
+		return err
+	}
 	fmt.Println()
 	fmt.Println()
 	for _, acc := range accounts {
@@ -103,10 +112,13 @@ func (c *AppsInfoCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 
 	app, err := api.Application(c.AccountID, c.AppID)
 	s.Stop()
-	fmt.Println()
 	if err != nil {
 		return err
 	}
+	if ok, err := WriteStructured(cli, os.Stdout, app); ok {
+		return err
+	}
+	fmt.Println()
 
 	if !(cli.Quiet){
 		fmt.Printf("🌎🌏🌍\n")
@@ -181,8 +193,9 @@ func (c *AppsCreateCmd) Run(logWriters *LogWriters) (err error) {
 	s := NewSpinner(fmt.Sprintf("Creating new app %s", c.Hostname),logWriters)
 	s.Start()
 
-	api.Timeout = 120 * time.Second // this specific request can take a long time
-	r, err := api.ApplicationCreate(c.AccountID, c.Hostname, c.Origin, c.StackName)
+	client := api.DefaultClient()
+	client.Timeout = 120 * time.Second // this specific request can take a long time
+	r, err := client.ApplicationCreate(context.Background(), c.AccountID, c.Hostname, c.Origin, c.StackName)
 	s.Stop()
 	fmt.Println()
 	if err != nil {
@@ -217,8 +230,9 @@ func (c *AppsDeleteCmd) Run(logWriters *LogWriters) (err error) {
 	s := NewSpinner(fmt.Sprintf("Deleting app with id '%d'", c.AppID),logWriters)
 	s.Start()
 
-	api.Timeout = 120 * time.Second // this specific request can take a long time
-	_, err = api.ApplicationDelete(c.AccountID, c.AppID)
+	client := api.DefaultClient()
+	client.Timeout = 120 * time.Second // this specific request can take a long time
+	_, err = client.ApplicationDelete(context.Background(), c.AccountID, c.AppID)
 	s.Stop()
 	if err != nil {
 		return err
@@ -241,6 +255,9 @@ func (c *AppsStacksCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 	if err != nil {
 		return fmt.Errorf("unable to look up stacks: %w", err)
 	}
+	if ok, err := WriteStructured(cli, os.Stdout, k); ok {
+		return err
+	}
 
 	table := NewTable(cli, os.Stdout)
 	table.SetHeader([]string{"Name", "Label", "Description", "Type"})
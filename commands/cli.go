@@ -7,6 +7,7 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/rs/zerolog"
+	"github.com/section/sectionctl/api"
 	"github.com/willabides/kongplete"
 )
 
@@ -36,18 +37,34 @@ type CLI struct {
 	Domains            DomainsCmd                   `cmd help:"Manage domains on Section"`
 	Certs              CertsCmd                     `cmd help:"Manage certificates on Section"`
 	Deploy             DeployCmd                    `cmd help:"Deploy an app to Section"`
+	Config             ConfigCmd                    `cmd help:"View and change configuration files in an app environment"`
 	Logs               LogsCmd                      `cmd help:"Show logs from running applications"`
 	Ps                 PsCmd                        `cmd help:"Show status of running applications"`
 	Version            VersionCmd                   `cmd help:"Print sectionctl version"`
 	WhoAmI             WhoAmICmd                    `cmd name:"whoami" help:"Show information about the currently authenticated user"`
+	Profiles           ProfileCmd                   `cmd name:"profile" help:"Manage profiles for multiple Section endpoints and accounts"`
 	Debug              debugFlag                    `env:"DEBUG" default:"false" help:"Enable debug output"`
 	DebugOutput        debugOutputFlag              `short:"out" help:"Enable logging on the debug output."`
 	DebugFile          DebugFileFlag                `help:"File path where debug output should be written"`
+	Profile            string                       `env:"SECTION_PROFILE" help:"Profile from the sectionctl config to use. Defaults to the current profile, see 'sectionctl profile'."`
 	SectionToken       string                       `env:"SECTION_TOKEN" help:"Secret token for API auth"`
+	CredentialKey      string                       `env:"SECTION_CREDENTIAL_KEY" help:"Key the API token is stored under in the credential store. Defaults to the host of the Section API prefix."`
+	CredentialStore    string                       `enum:"auto,keyring,file,env" default:"auto" env:"SECTION_CREDENTIAL_STORE" help:"Where the API token is stored: keyring, an encrypted file, env to only read SECTION_TOKEN, or auto to use the keyring and fall back to the file."`
 	SectionAPIPrefix   *url.URL                     `default:"https://aperture.section.io" env:"SECTION_API_PREFIX"`
 	SectionAPITimeout  time.Duration                `default:"30s" env:"SECTION_API_TIMEOUT" help:"Request timeout for the Section API"`
+	SectionAPIRetries  int                          `name:"section-api-max-attempts" default:"3" env:"SECTION_API_MAX_ATTEMPTS" help:"Maximum attempts for idempotent Section API requests that are rate limited or fail transiently"`
 	InstallCompletions kongplete.InstallCompletions `cmd:"" help:"install shell completions"`
 	Quiet              quietFlag                    `env:"SECTION_CI" help:"Enables minimal logging, for use in continuous integration."`
+	Output             string                       `enum:"table,json,yaml" default:"table" env:"SECTION_OUTPUT" help:"Output format for list and info commands: table, json, or yaml."`
+	Template           string                       `help:"Format output for list and info commands using a Go template."`
+}
+
+// TokenKey returns the key the API token is stored under in the credential store
+func (c *CLI) TokenKey() string {
+	if c.CredentialKey != "" {
+		return c.CredentialKey
+	}
+	return api.PrefixURI.Host
 }
 
 type LogWriters struct {
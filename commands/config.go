@@ -0,0 +1,518 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitdiff "github.com/go-git/go-git/v5/utils/diff"
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/api"
+	"github.com/section/sectionctl/version"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ConfigCmd views and changes the configuration files in an app environment's repository
+type ConfigCmd struct {
+	AccountID     int    `short:"a" help:"AccountID of the app."`
+	AppID         int    `short:"i" help:"AppID of the app."`
+	Environment   string `short:"e" default:"Production" help:"Environment to configure. (name of git branch ie: Production, staging, development)"`
+	Via           string `enum:"git,api" default:"git" help:"How to change files: git commits and pushes to the environment repository, api updates JSON files through the Section API."`
+	Message       string `short:"m" help:"Message for the commit recording the change in the environment repository."`
+	PushRetries   int    `default:"3" help:"Number of times to retry a change when the environment repository changes during it."`
+	CloneMemoryMB int    `name:"clone-memory-mb" default:"256" help:"Largest environment repository to clone into memory, in megabytes. Larger ones are cloned to a temporary directory that is removed afterwards. 0 always clones to disk."`
+	GitRemote     string `placeholder:"URL" help:"URL of the environment repository. Defaults to the app's repository under --section-api-prefix. A file:// URL of a local bare repository can stand in for it."`
+
+	Get  ConfigGetCmd  `cmd help:"Print a configuration file, or list the files in the environment."`
+	Set  ConfigSetCmd  `cmd help:"Replace a configuration file with a local file, or stdin."`
+	Edit ConfigEditCmd `cmd help:"Edit a configuration file in $VISUAL or $EDITOR."`
+	Diff ConfigDiffCmd `cmd help:"Show how a local file differs from a configuration file."`
+}
+
+// deployCmd returns the deploy flags that locate the environment repository, so it can be cloned and pushed to
+func (c *ConfigCmd) deployCmd() *DeployCmd {
+	return &DeployCmd{
+		AccountID:     c.AccountID,
+		AppID:         c.AppID,
+		Environment:   c.Environment,
+		PushRetries:   c.PushRetries,
+		CloneMemoryMB: c.CloneMemoryMB,
+		GitRemote:     c.GitRemote,
+	}
+}
+
+// ConfigGetCmd prints a configuration file
+type ConfigGetCmd struct {
+	Path string `arg optional help:"File in the environment repository, such as section.config.json or varnish/default.vcl. Lists the files if not given."`
+}
+
+// Run executes the command
+func (g *ConfigGetCmd) Run(logWriters *LogWriters, c *ConfigCmd) (err error) {
+	return g.run(logWriters, c, os.Stdout)
+}
+
+// run prints the file, or the list of files, to out
+func (g *ConfigGetCmd) run(logWriters *LogWriters, c *ConfigCmd, out io.Writer) (err error) {
+	er, err := cloneEnvironmentRepo(c.deployCmd(), logWriters, 1)
+	if err != nil {
+		return err
+	}
+	defer er.Close()
+
+	if g.Path == "" {
+		paths, err := configFiles(er.repo)
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			fmt.Fprintln(out, p)
+		}
+		return nil
+	}
+	contents, err := configFile(er.repo, g.Path)
+	if err != nil {
+		return err
+	}
+	if contents == nil {
+		return fmt.Errorf("%s not found in the %s environment", g.Path, c.Environment)
+	}
+	_, err = out.Write(contents)
+	return err
+}
+
+// ConfigSetCmd replaces a configuration file
+type ConfigSetCmd struct {
+	Path string `arg help:"File in the environment repository, such as varnish/default.vcl. It's created if it doesn't exist."`
+	File string `arg optional default:"-" help:"Local file with the new contents. Reads stdin if not given, or -."`
+}
+
+// Run executes the command
+func (s *ConfigSetCmd) Run(logWriters *LogWriters, c *ConfigCmd) (err error) {
+	return s.run(logWriters, c, os.Stdin, os.Stdout)
+}
+
+// run replaces the file, reading - from in, and writes the changes to out
+func (s *ConfigSetCmd) run(logWriters *LogWriters, c *ConfigCmd, in io.Reader, out io.Writer) (err error) {
+	var contents []byte
+	if s.File == "-" {
+		contents, err = ioutil.ReadAll(in)
+	} else {
+		contents, err = ioutil.ReadFile(s.File)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read the new contents of %s: %w", s.Path, err)
+	}
+	if err := c.checkVia(s.Path); err != nil {
+		return err
+	}
+	if err := validateConfigFile(s.Path, contents); err != nil {
+		return err
+	}
+
+	er, err := cloneEnvironmentRepo(c.deployCmd(), logWriters, 1)
+	if err != nil {
+		return err
+	}
+	defer er.Close()
+	current, err := configFile(er.repo, s.Path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, contents) {
+		log.Info().Msg(fmt.Sprintf("%s is already up to date", s.Path))
+		return nil
+	}
+	fmt.Fprint(out, unifiedDiff(s.Path, current, contents))
+	return c.apply(er, s.Path, current, contents, logWriters)
+}
+
+// ConfigEditCmd edits a configuration file in the user's editor
+type ConfigEditCmd struct {
+	Path string `arg help:"File in the environment repository, such as varnish/default.vcl."`
+	Yes  bool   `short:"y" help:"Apply the changes without asking."`
+}
+
+// Run executes the command
+func (e *ConfigEditCmd) Run(logWriters *LogWriters, c *ConfigCmd) (err error) {
+	return e.run(logWriters, c, os.Stdin, os.Stdout)
+}
+
+// run edits the file, writing the changes to out and reading the confirmation from in
+func (e *ConfigEditCmd) run(logWriters *LogWriters, c *ConfigCmd, in io.Reader, out io.Writer) (err error) {
+	if err := c.checkVia(e.Path); err != nil {
+		return err
+	}
+	er, err := cloneEnvironmentRepo(c.deployCmd(), logWriters, 1)
+	if err != nil {
+		return err
+	}
+	defer er.Close()
+	current, err := configFile(er.repo, e.Path)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("%s not found in the %s environment. Create it with 'sectionctl config set'", e.Path, c.Environment)
+	}
+
+	// keep the file's name, so the editor highlights it
+	dir, err := ioutil.TempDir("", "sectionctl-config-*")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, path.Base(e.Path))
+	if err := ioutil.WriteFile(tmp, current, 0600); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	contents, err := editFile(tmp)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := validateConfigFile(e.Path, contents); err != nil {
+		// keep the edited file, so the changes aren't lost
+		return fmt.Errorf("%w. Your changes are saved in %s", err, tmp)
+	}
+	os.RemoveAll(dir)
+	if bytes.Equal(current, contents) {
+		log.Info().Msg(fmt.Sprintf("No changes to %s", e.Path))
+		return nil
+	}
+
+	fmt.Fprint(out, unifiedDiff(e.Path, current, contents))
+	if !e.Yes {
+		fmt.Fprintf(out, "Apply these changes to %s in %s? [y/N] ", e.Path, c.Environment)
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			log.Info().Msg("Changes discarded")
+			return nil
+		}
+	}
+	return c.apply(er, e.Path, current, contents, logWriters)
+}
+
+// ConfigDiffCmd compares a local file to a configuration file
+type ConfigDiffCmd struct {
+	Path string `arg help:"File in the environment repository, such as varnish/default.vcl."`
+	File string `arg type:"existingfile" help:"Local file to compare it to."`
+}
+
+// Run executes the command
+func (d *ConfigDiffCmd) Run(logWriters *LogWriters, c *ConfigCmd) (err error) {
+	return d.run(logWriters, c, os.Stdout)
+}
+
+// run writes the differences to out
+func (d *ConfigDiffCmd) run(logWriters *LogWriters, c *ConfigCmd, out io.Writer) (err error) {
+	contents, err := ioutil.ReadFile(d.File)
+	if err != nil {
+		return err
+	}
+	er, err := cloneEnvironmentRepo(c.deployCmd(), logWriters, 1)
+	if err != nil {
+		return err
+	}
+	defer er.Close()
+	current, err := configFile(er.repo, d.Path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, unifiedDiff(d.Path, current, contents))
+	return nil
+}
+
+// checkVia checks that the file at path can be changed --via the API, which only updates JSON files
+func (c *ConfigCmd) checkVia(path string) error {
+	if c.Via == "api" && !strings.HasSuffix(path, ".json") {
+		return fmt.Errorf("only JSON files can be changed with --via api, use --via git to change %s", path)
+	}
+	return nil
+}
+
+// apply changes the file at path from current to contents, as set by --via
+func (c *ConfigCmd) apply(er *environmentRepo, path string, current, contents []byte, logWriters *LogWriters) error {
+	if c.Via == "api" {
+		var value interface{}
+		if err := json.Unmarshal(contents, &value); err != nil {
+			return err
+		}
+		err := api.ApplicationEnvironmentModuleUpdate(c.AccountID, c.AppID, c.Environment, path, []api.EnvironmentUpdateCommand{{Op: "replace", Value: value}})
+		if err != nil {
+			return fmt.Errorf("unable to update %s: %w", path, err)
+		}
+		log.Info().Msg(fmt.Sprintf("Updated %s in %s", path, c.Environment))
+		return nil
+	}
+
+	message := c.Message
+	if message == "" {
+		message = fmt.Sprintf("[sectionctl] updated %s.", path)
+	}
+	message = withTrailers(message, map[string]string{trailerVersion: version.Version})
+	err := commitConfigFile(er, c.deployCmd(), path, current, contents, message, logWriters)
+	if err != nil {
+		return err
+	}
+	log.Info().Msg(fmt.Sprintf("Updated %s in %s", path, c.Environment))
+	return nil
+}
+
+// configFiles lists the files at HEAD in the environment repository, except the deployed payloads
+func configFiles(r *git.Repository) (paths []string, err error) {
+	ref, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving the git HEAD: %w", err)
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	files, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
+	err = files.ForEach(func(f *object.File) error {
+		if path.Base(f.Name) != ".section-external-source.json" {
+			paths = append(paths, f.Name)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// configFile returns the contents of the file at path at HEAD, or nil if there is no such file
+func configFile(r *git.Repository, path string) ([]byte, error) {
+	f, err := headFile(r, path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open contents of file: %w", err)
+	}
+	return []byte(contents), nil
+}
+
+// validateConfigFile checks the new contents of the configuration file at path.
+//
+// JSON files must be valid JSON, and every module in section.config.json's proxychain needs a
+// unique name and an image.
+func validateConfigFile(path string, contents []byte) error {
+	if !strings.HasSuffix(path, ".json") {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(contents, &v); err != nil {
+		return fmt.Errorf("%s is not valid JSON: %v", path, err)
+	}
+	if path != "section.config.json" {
+		return nil
+	}
+	sectionConfig, err := ParseSectionConfig(string(contents))
+	if err != nil {
+		return fmt.Errorf("%s is not a valid section config: %v", path, err)
+	}
+	if len(sectionConfig.Proxychain) == 0 {
+		return fmt.Errorf("%s has no modules in its proxychain", path)
+	}
+	names := map[string]bool{}
+	for i, m := range sectionConfig.Proxychain {
+		if m.Name == "" || m.Image == "" {
+			return fmt.Errorf("module %d in the proxychain of %s needs a name and an image", i+1, path)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("module %s appears more than once in the proxychain of %s", m.Name, path)
+		}
+		names[m.Name] = true
+	}
+	return nil
+}
+
+// commitConfigFile writes contents to the file at path in the environment repository clone, then commits and pushes the change.
+//
+// If the push is rejected because the branch changed in the meantime, the branch is fetched again
+// and the change re-applied on top of it, up to --push-retries times, unless the file itself was
+// changed from current by someone else.
+func commitConfigFile(er *environmentRepo, c *DeployCmd, path string, current, contents []byte, message string, logWriters *LogWriters) error {
+	author := commitAuthor()
+	for attempt := 0; ; attempt++ {
+		w, err := er.repo.Worktree()
+		if err != nil {
+			return err
+		}
+		err = util.WriteFile(w.Filesystem, path, contents, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = w.Add(path)
+		if err != nil {
+			return err
+		}
+		author.When = time.Now()
+		_, err = w.Commit(message, &git.CommitOptions{
+			Author: &author,
+			Committer: &object.Signature{
+				Name:  "sectionctl",
+				Email: "noreply@section.io",
+				When:  author.When,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to make a commit on the temporary repository: %w", err)
+		}
+		err = er.repo.Push(&git.PushOptions{Auth: er.auth, Progress: logWriters.CarriageReturnWriter})
+		if err == nil {
+			return nil
+		}
+		if !isRejectedPush(err) || attempt >= c.PushRetries {
+			return fmt.Errorf("failed to push git changes: %w", err)
+		}
+		log.Warn().Err(err).Int("Attempt", attempt+1).Msg("The environment repository changed during the update, fetching it and trying again")
+
+		err = er.reset(c, logWriters)
+		if err != nil {
+			return fmt.Errorf("failed to fetch git changes: %w", err)
+		}
+		latest, err := configFile(er.repo, path)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(latest, contents) {
+			log.Info().Msg(fmt.Sprintf("%s was already updated by someone else", path))
+			return nil
+		}
+		if !bytes.Equal(latest, current) {
+			return fmt.Errorf("%s was changed by someone else while this change was in progress, so it was not updated. Run the command again to change the latest version", path)
+		}
+	}
+}
+
+// editFile opens the file at path in $VISUAL or $EDITOR, and returns its contents once the editor exits
+func editFile(path string) ([]byte, error) {
+	editor := firstEnv([]string{"VISUAL", "EDITOR"})
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// the editor may have arguments, like "code --wait"
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// diffContext is the number of unchanged lines shown around each change in a diff
+const diffContext = 3
+
+// diffLine is a line of a diff, with its operation: ' ' if unchanged, '-' if removed or '+' if added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns a unified diff of the file at path changing from a to b, or an empty string if they're the same
+func unifiedDiff(path string, a, b []byte) string {
+	var lines []diffLine
+	for _, d := range gitdiff.Do(string(a), string(b)) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l != "" {
+				lines = append(lines, diffLine{op: op, text: strings.TrimSuffix(l, "\n")})
+			}
+		}
+	}
+
+	var out strings.Builder
+	// aLine and bLine are the line numbers in a and b of the next line
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+		}
+		// a hunk runs from some context before this change to some context after the last change
+		// that's near enough to it
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end, unchanged := i, 0
+		for j := i; j < len(lines) && unchanged <= 2*diffContext; j++ {
+			if lines[j].op == ' ' {
+				unchanged++
+				continue
+			}
+			end, unchanged = j+1, 0
+		}
+		if end += diffContext; end > len(lines) {
+			end = len(lines)
+		}
+
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		var aCount, bCount int
+		var hunk strings.Builder
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+			hunk.WriteString(string(l.op) + l.text + "\n")
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n%s", hunkRange(aStart, aCount), hunkRange(bStart, bCount), hunk.String())
+		aLine, bLine, i = aStart+aCount, bStart+bCount, end
+	}
+	return out.String()
+}
+
+// hunkRange formats the lines a hunk covers in one side of a unified diff
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// an empty range is numbered from the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
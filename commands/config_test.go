@@ -0,0 +1,362 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// helperConfigAPI points the API at a server that only accepts module updates, recording the last one
+func helperConfigAPI(t *testing.T) (filePath *string, update *[]api.EnvironmentUpdateCommand) {
+	filePath, update = new(string), new([]api.EnvironmentUpdateCommand)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPatch && r.URL.Path == "/api/v1/account/1/application/2/environment/dev/update":
+			*filePath = r.Header.Get("filepath")
+			if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.PrefixURI = u
+	api.MaxAttempts = 1
+	return filePath, update
+}
+
+// helperBranchFile reads the file at path on branch of the repository at dir
+func helperBranchFile(t *testing.T, dir string, branch string, path string) (contents string, message string) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := commit.File(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err = f.Contents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents, commit.Message
+}
+
+func TestCommandsConfigUnifiedDiff(t *testing.T) {
+	var testCases = []struct {
+		name string
+		a    string
+		b    string
+		diff string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", ""},
+		{"changed line", "1\n2\n3\n4\n5\n6\n7\n8\n", "1\n2\n3\n4\nfive\n6\n7\n8\n", "--- a/default.vcl\n+++ b/default.vcl\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"},
+		{"new file", "", "a\nb\n", "--- a/default.vcl\n+++ b/default.vcl\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"changes far apart", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n", "--- a/default.vcl\n+++ b/default.vcl\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n"},
+		{"changes close together", "1\n2\n3\n4\n5\n6\n", "one\n2\n3\n4\n5\nsix\n", "--- a/default.vcl\n+++ b/default.vcl\n@@ -1,6 +1,6 @@\n-1\n+one\n 2\n 3\n 4\n 5\n-6\n+six\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Invoke
+			diff := unifiedDiff("default.vcl", []byte(tc.a), []byte(tc.b))
+
+			// Test
+			assert.Equal(tc.diff, diff)
+		})
+	}
+}
+
+func TestCommandsConfigValidate(t *testing.T) {
+	var testCases = []struct {
+		path     string
+		contents string
+		err      string
+	}{
+		{"varnish/default.vcl", "vcl 4.0;", ""},
+		{"nodejs/config.json", `{"a": 1}`, ""},
+		{"nodejs/config.json", `{"a": 1`, "not valid JSON"},
+		{"section.config.json", `{"proxychain": [{"name": "varnish", "image": "varnish:6.0"}]}`, ""},
+		{"section.config.json", `{"proxychain": []}`, "no modules"},
+		{"section.config.json", `{"proxychain": [{"name": "varnish"}]}`, "module 1 in the proxychain of section.config.json needs a name and an image"},
+		{"section.config.json", `{"proxychain": [{"name": "varnish", "image": "varnish:6.0"}, {"name": "varnish", "image": "varnish:7.0"}]}`, "varnish appears more than once"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.contents, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Invoke
+			err := validateConfigFile(tc.path, []byte(tc.contents))
+
+			// Test
+			if tc.err == "" {
+				assert.NoError(err)
+			} else if assert.Error(err) {
+				assert.Contains(err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestCommandsConfigSetThenGet(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	helperConfigAPI(t)
+	remote, bare := helperEnvironmentRemote(t)
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := ConfigCmd{GitRemote: remote, Environment: "dev", Via: "git", CloneMemoryMB: 256, Message: "Cache for longer"}
+	var diff, got, list strings.Builder
+
+	// Invoke
+	setErr := (&ConfigSetCmd{Path: "varnish/default.vcl", File: "-"}).run(&logWriters, &c, strings.NewReader("vcl 4.0;\n"), &diff)
+	getErr := (&ConfigGetCmd{Path: "varnish/default.vcl"}).run(&logWriters, &c, &got)
+	listErr := (&ConfigGetCmd{}).run(&logWriters, &c, &list)
+	missingErr := (&ConfigGetCmd{Path: "nginx/nginx.conf"}).run(&logWriters, &c, io.Discard)
+
+	// Test
+	assert.NoError(setErr)
+	assert.NoError(getErr)
+	assert.NoError(listErr)
+	assert.Equal("--- a/varnish/default.vcl\n+++ b/varnish/default.vcl\n@@ -0,0 +1 @@\n+vcl 4.0;\n", diff.String())
+	assert.Equal("vcl 4.0;\n", got.String())
+	assert.Equal("section.config.json\nvarnish/default.vcl\n", list.String())
+	if assert.Error(missingErr) {
+		assert.Contains(missingErr.Error(), "nginx/nginx.conf not found in the dev environment")
+	}
+	contents, message := helperBranchFile(t, bare, "dev", "varnish/default.vcl")
+	assert.Equal("vcl 4.0;\n", contents)
+	body, trailers := parseTrailers(message)
+	assert.Equal("Cache for longer", body)
+	assert.Contains(trailers, trailerVersion)
+}
+
+func TestCommandsConfigSetRejectsInvalidJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, bare := helperEnvironmentRemote(t)
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := ConfigCmd{GitRemote: remote, Environment: "dev", Via: "git", CloneMemoryMB: 256}
+	before, _ := helperBranchFile(t, bare, "dev", "section.config.json")
+
+	// Invoke
+	err := (&ConfigSetCmd{Path: "section.config.json", File: "-"}).run(&logWriters, &c, strings.NewReader(`{"proxychain": [{"name": "varnish"}]}`), io.Discard)
+
+	// Test
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "needs a name and an image")
+	}
+	after, _ := helperBranchFile(t, bare, "dev", "section.config.json")
+	assert.Equal(before, after)
+}
+
+func TestCommandsConfigSetViaAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	filePath, update := helperConfigAPI(t)
+	remote, bare := helperEnvironmentRemote(t)
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := ConfigCmd{AccountID: 1, AppID: 2, GitRemote: remote, Environment: "dev", Via: "api", CloneMemoryMB: 256}
+	sectionConfig := `{"proxychain": [{"name": "varnish", "image": "varnish:7.0"}, {"name": "nodejs", "image": "nodejs-basic:14.17.0"}]}`
+	before, _ := helperBranchFile(t, bare, "dev", "section.config.json")
+
+	// Invoke
+	err := (&ConfigSetCmd{Path: "section.config.json", File: "-"}).run(&logWriters, &c, strings.NewReader(sectionConfig), io.Discard)
+	vclErr := (&ConfigSetCmd{Path: "varnish/default.vcl", File: "-"}).run(&logWriters, &c, strings.NewReader("vcl 4.0;"), io.Discard)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("section.config.json", *filePath)
+	if assert.Len(*update, 1) {
+		assert.Equal("replace", (*update)[0].Op)
+		value, _ := json.Marshal((*update)[0].Value)
+		assert.JSONEq(sectionConfig, string(value))
+	}
+	after, _ := helperBranchFile(t, bare, "dev", "section.config.json")
+	assert.Equal(before, after, "the API makes the change, not sectionctl")
+	if assert.Error(vclErr) {
+		assert.Contains(vclErr.Error(), "only JSON files")
+	}
+}
+
+func TestCommandsConfigEdit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+
+	var testCases = []struct {
+		name    string
+		script  string
+		answer  string
+		image   string
+		err     string
+		applied bool
+	}{
+		{"applied", `sed -i.bak 's/varnish:6.0/varnish:7.0/' "$1"`, "y\n", "varnish:7.0", "", true},
+		{"discarded", `sed -i.bak 's/varnish:6.0/varnish:7.0/' "$1"`, "n\n", "varnish:6.0", "", false},
+		{"unchanged", `true`, "", "varnish:6.0", "", false},
+		{"editor fails", `exit 1`, "y\n", "varnish:6.0", "editor", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			helperConfigAPI(t)
+			remote, bare := helperEnvironmentRemote(t)
+			editor := filepath.Join(t.TempDir(), "editor.sh")
+			assert.NoError(ioutil.WriteFile(editor, []byte("#!/bin/sh\n"+tc.script+"\n"), 0755))
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", editor)
+			logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+			c := ConfigCmd{GitRemote: remote, Environment: "dev", Via: "git", CloneMemoryMB: 256}
+			var out strings.Builder
+
+			// Invoke
+			err := (&ConfigEditCmd{Path: "section.config.json"}).run(&logWriters, &c, strings.NewReader(tc.answer), &out)
+
+			// Test
+			if tc.err != "" {
+				if assert.Error(err) {
+					assert.Contains(err.Error(), tc.err)
+				}
+			} else {
+				assert.NoError(err)
+			}
+			contents, _ := helperBranchFile(t, bare, "dev", "section.config.json")
+			sectionConfig, err := ParseSectionConfig(contents)
+			assert.NoError(err)
+			assert.Equal(tc.image, sectionConfig.Proxychain[0].Image)
+			if tc.applied || tc.answer == "n\n" {
+				assert.Contains(out.String(), "+++ b/section.config.json")
+				assert.Contains(out.String(), "Apply these changes to section.config.json in dev? [y/N]")
+			}
+		})
+	}
+}
+
+func TestCommandsConfigEditKeepsInvalidChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+	assert := assert.New(t)
+
+	// Setup
+	remote, _ := helperEnvironmentRemote(t)
+	editor := filepath.Join(t.TempDir(), "editor.sh")
+	assert.NoError(ioutil.WriteFile(editor, []byte("#!/bin/sh\necho '{\"proxychain\": [' > \"$1\"\n"), 0755))
+	t.Setenv("VISUAL", editor)
+	t.Setenv("TMPDIR", t.TempDir())
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := ConfigCmd{GitRemote: remote, Environment: "dev", Via: "git", CloneMemoryMB: 256}
+
+	// Invoke
+	err := (&ConfigEditCmd{Path: "section.config.json", Yes: true}).run(&logWriters, &c, strings.NewReader(""), io.Discard)
+
+	// Test
+	if assert.Error(err) {
+		i := strings.Index(err.Error(), "Your changes are saved in ")
+		if assert.True(i >= 0, err.Error()) {
+			saved, readErr := ioutil.ReadFile(err.Error()[i+len("Your changes are saved in "):])
+			assert.NoError(readErr)
+			assert.Equal("{\"proxychain\": [\n", string(saved))
+		}
+	}
+}
+
+func TestCommandsConfigDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, _ := helperEnvironmentRemote(t)
+	local := filepath.Join(t.TempDir(), "section.config.json")
+	assert.NoError(ioutil.WriteFile(local, []byte(`{"proxychain": [{"name": "varnish", "image": "varnish:7.0"}, {"name": "nodejs", "image": "nodejs-basic:14.17.0"}]}`), 0644))
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := ConfigCmd{GitRemote: remote, Environment: "dev", CloneMemoryMB: 256}
+	var out strings.Builder
+
+	// Invoke
+	err := (&ConfigDiffCmd{Path: "section.config.json", File: local}).run(&logWriters, &c, &out)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(fmt.Sprintf("--- a/section.config.json\n+++ b/section.config.json\n@@ -1 +1 @@\n-%s\n+%s\n",
+		`{"proxychain": [{"name": "varnish", "image": "varnish:6.0"}, {"name": "nodejs", "image": "nodejs-basic:14.17.0"}]}`,
+		`{"proxychain": [{"name": "varnish", "image": "varnish:7.0"}, {"name": "nodejs", "image": "nodejs-basic:14.17.0"}]}`), out.String())
+}
+
+func TestCommandsConfigCommitRetriesRejectedPush(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		concurrent string
+		err        string
+	}{
+		{"another file changed", "nodejs/.section-external-source.json", ""},
+		{"same file changed", "varnish/default.vcl", "was changed by someone else"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			helperConfigAPI(t)
+			remote, bare := helperEnvironmentRemote(t)
+			helperConcurrentCommit(t, remote, "varnish/default.vcl", "vcl 4.0;\n")
+			logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+			c := ConfigCmd{GitRemote: remote, Environment: "dev", Via: "git", CloneMemoryMB: 256, PushRetries: 3}
+			er, err := cloneEnvironmentRepo(c.deployCmd(), &logWriters, 0)
+			assert.NoError(err)
+			defer er.Close()
+			helperConcurrentCommit(t, remote, tc.concurrent, `{"id": "concurrent"}`)
+
+			// Invoke
+			err = commitConfigFile(er, c.deployCmd(), "varnish/default.vcl", []byte("vcl 4.0;\n"), []byte("vcl 4.1;\n"), "update", &logWriters)
+
+			// Test
+			contents, _ := helperBranchFile(t, bare, "dev", "varnish/default.vcl")
+			if tc.err != "" {
+				if assert.Error(err) {
+					assert.Contains(err.Error(), tc.err)
+				}
+				assert.Equal(`{"id": "concurrent"}`, contents)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("vcl 4.1;\n", contents)
+		})
+	}
+}
@@ -2,9 +2,11 @@ package commands
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +24,8 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/section/sectionctl/api"
 )
 
@@ -34,25 +39,198 @@ type DeployCmd struct {
 	Environment    string        `short:"e" default:"Production" help:"Environment to deploy application to. (name of git branch ie: Production, staging, development)"`
 	Directory      string        `short:"C" default:"." help:"Directory which contains the application to deploy."`
 	ServerURL      *url.URL      `default:"https://aperture.section.io/new/code_upload/v1/upload" help:"URL to upload application to"`
-	Timeout        time.Duration `default:"600s" help:"Timeout of individual HTTP requests."`
-	SkipDelete     bool          `help:"Skip delete of temporary tarball created to upload app."`
+	Timeout        time.Duration `default:"600s" help:"Timeout of individual HTTP requests, including each chunk of a chunked upload."`
+	UploadMode     string        `name:"upload" enum:"auto,single,chunked" default:"single" help:"How to upload the app: in a single request, or in chunks that are retried and can be resumed, where the upload service supports them. auto uses chunks for apps bigger than a chunk, falling back to a single request if a chunked upload can't be started."`
+	ChunkSizeMB    int           `name:"chunk-size-mb" default:"16" help:"Size of each chunk of a chunked upload, in megabytes."`
+	ChunkRetries   int           `default:"5" help:"Number of times to retry each chunk of a chunked upload."`
+	SkipDelete     bool          `help:"Skip delete of temporary tarball created to upload app. A chunked upload of the same app that is interrupted can then be resumed."`
 	SkipValidation bool          `help:"Skip validation of the workload before pushing into Section. Use with caution."`
-	AppPath        string        `default:"nodejs" help:"Path of NodeJS application in environment repository."`
+	SkipValidator  []string      `placeholder:"NAME" help:"Skip one validation check (static-site, node-app, entry-file, node-engine, native-addons, dev-dependencies, symlinks, file-size). Can be repeated."`
+	LargeFileMB    int           `name:"large-file-mb" default:"100" help:"Warn about packaged files larger than this many megabytes."`
+	Kind           string        `enum:"nodejs,static,generic," default:"" help:"Kind of module to deploy: nodejs, static or generic. Detected from the environment's proxychain by default."`
+	AppPath        string        `help:"Module to deploy to, which is also its path in the environment repository. Detected from the environment's proxychain by default, falling back to nodejs."`
+	Ignore         []string      `help:"Pattern of files to exclude from the package, using .gitignore syntax. Added after patterns in .sectionignore."`
+	Artifact       string        `type:"existingfile" help:"Deploy this tarball, as made by 'sectionctl deploy package', instead of packaging --directory. It is checked, then uploaded as it is."`
+	Build          bool          `help:"Install dependencies and run the build script from package.json (section.build, or build) in a clean copy of the app, then package the result."`
+	DryRun         bool          `help:"Package the app without uploading or deploying it."`
+	Force          bool          `help:"Deploy even if the package is identical to the one already deployed."`
+	ReplaceConcurrent bool       `help:"Replace the payload of another deploy to the same module that lands while this one is in progress, instead of stopping."`
+	ListFiles      bool          `help:"Print every file that is packaged."`
+	Wait           bool          `help:"Wait until every instance is running the new payload, and fail if it doesn't."`
+	WaitTimeout    time.Duration `default:"10m" help:"How long to wait for the new payload to roll out when using --wait."`
+	WaitInterval   time.Duration `default:"5s" help:"Interval to poll the app's status when using --wait."`
+	WaitGrace      time.Duration `default:"1m" help:"How long an instance running the new payload may be out of service before --wait fails the rollout."`
+	Message        string        `short:"m" help:"Message for the commit recording the deploy in the environment repository. Trailers tracing the deploy to its source are added to it."`
+	PushRetries    int           `default:"3" help:"Number of times to retry recording a deploy when the environment repository changes during it."`
+	CloneMemoryMB  int           `name:"clone-memory-mb" default:"256" help:"Largest environment repository to clone into memory, in megabytes. Larger ones are cloned to a temporary directory that is removed afterwards. 0 always clones to disk."`
+	GitRemote      string        `placeholder:"URL" help:"URL of the environment repository that deploys are recorded in. Defaults to the app's repository under --section-api-prefix. A file:// URL of a local bare repository can stand in for it."`
+
+	Push     DeployPushCmd     `cmd default:"1" help:"Package and upload an app, then deploy it. This is the default."`
+	Package  DeployPackageCmd  `cmd help:"Package an app into a tarball, without uploading it, to deploy later with --artifact."`
+	History  DeployHistoryCmd  `cmd help:"List previous deploys of an app environment."`
+	Rollback DeployRollbackCmd `cmd help:"Redeploy an earlier payload to an app environment, without uploading anything."`
+}
+
+// DeployPushCmd packages, uploads and deploys an app, using the flags on DeployCmd
+type DeployPushCmd struct{}
+
+// Run executes the command
+func (p *DeployPushCmd) Run(cli *CLI, ctx *kong.Context, logWriters *LogWriters, c *DeployCmd) (err error) {
+	return c.Deploy(cli, ctx, logWriters)
 }
 
 // UploadResponse represents the response from a request to the upload service.
 type UploadResponse struct {
 	PayloadID string `json:"payloadID"`
+	// SHA256 is the digest of the uploaded package's contents
+	SHA256 string `json:"-"`
 }
 
 // PayloadValue represents the value of a trigger update payload.
 type PayloadValue struct {
-	ID string `json:"section_payload_id"`
+	ID     string `json:"section_payload_id"`
+	SHA256 string `json:"section_payload_sha256,omitempty"`
+}
+
+// Deploy deploys an app to Section's edge
+func (c *DeployCmd) Deploy(cli *CLI, ctx *kong.Context, logWriters *LogWriters) (err error) {
+	// clone the environment repository first, as its section.config.json says what is being
+	// deployed. The same clone records the deploy once it's uploaded.
+	var target DeployTarget
+	var sc *SectionConfigJSON
+	if c.DryRun {
+		sc = c.lookupEnvironmentConfig(logWriters)
+	} else {
+		target, err = globalGitService.OpenDeploy(c, logWriters)
+		if err != nil {
+			return fmt.Errorf("unable to clone the environment repository: %w", err)
+		}
+		defer target.Close()
+		sc = environmentConfig(target)
+	}
+	kind, err := c.resolveKind(sc)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg(Green("Deploying your %s to Account ID: %d, App ID: %d, Environment %s, Module %s", kind.Description, c.AccountID, c.AppID, c.Environment, c.AppPath))
+
+	var tarball, digest string
+	var packaged int
+	if c.Artifact != "" {
+		if c.Build {
+			return fmt.Errorf("--build can't be used with --artifact, which is deployed as it is")
+		}
+		tarball = c.Artifact
+		digest, packaged, err = ReadArtifact(tarball, kind)
+		if err != nil {
+			return fmt.Errorf("not a valid %s artifact: %w", kind.Description, err)
+		}
+		log.Info().Str("Artifact", tarball).Str("SHA-256", digest).Msg("Deploying artifact")
+	} else {
+		tempFile, err := ioutil.TempFile("", "sectionctl-deploy.*.tar.gz")
+		if err != nil {
+			return fmt.Errorf("couldn't create a temp file: %v", err)
+		}
+		tarball = tempFile.Name()
+		defer func() {
+			if !c.SkipDelete {
+				os.Remove(tarball)
+				os.Remove(tarball + ".upload.json")
+			}
+		}()
+
+		packaged, digest, err = c.packageApp(tempFile, kind, sc, logWriters)
+		if err != nil {
+			tempFile.Close()
+			return err
+		}
+		err = tempFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to pack files: %v", err)
+		}
+
+		if c.SkipDelete {
+			// name the tarball after its contents, so an interrupted upload of the same app can be resumed
+			kept := filepath.Join(filepath.Dir(tarball), fmt.Sprintf("sectionctl-deploy.%.16s.tar.gz", digest))
+			err = os.Rename(tarball, kept)
+			if err != nil {
+				return fmt.Errorf("unable to keep tarball: %v", err)
+			}
+			tarball = kept
+			log.Info().Str("Tarball", tarball).Msg("Keeping tarball")
+		}
+	}
+
+	log.Debug().Str("Temporar file location", tarball)
+	stat, err := os.Stat(tarball)
+	if err != nil {
+		return fmt.Errorf("%s: could not stat, got error: %s", tarball, err)
+	}
+	if stat.Size() > MaxFileSize {
+		return fmt.Errorf("failed to upload tarball: file size (%d) is greater than (%d)", stat.Size(), MaxFileSize)
+	}
+
+	if c.DryRun {
+		log.Info().Msg(fmt.Sprintf("Dry run: packaged %d files and directories into %s. Nothing was uploaded.", packaged, formatBytes(stat.Size())))
+		return nil
+	}
+
+	// before uploading, check the module is configured, and whether the package is already deployed
+	current, err := target.Current()
+	switch {
+	case errors.Is(err, object.ErrFileNotFound):
+		return c.notConfiguredError(kind)
+	case err != nil:
+		log.Warn().Err(err).Msg("Unable to look up the deployed payload")
+	case current.SHA256 == digest && !c.Force:
+		log.Info().Str("Payload ID", current.ID).Msg("This package is already deployed, so there is nothing to do. Use --force to deploy it again.")
+		return nil
+	}
+
+	artifactSizeMB := stat.Size() / 1024 / 1024
+	log.Debug().Msg(fmt.Sprintf("Upload artifact is %dMB (%d bytes) large", artifactSizeMB, stat.Size()))
+	progress := NewProgressBar("Uploading app", stat.Size(), cli, logWriters)
+	response, err := c.upload(tarball, stat.Size(), digest, progress)
+	progress.Finish()
+	if err != nil {
+		return err
+	}
+	response.SHA256 = digest
+
+	err = target.Record(response)
+	if err != nil {
+		var concurrent *concurrentDeployError
+		if errors.As(err, &concurrent) {
+			return err
+		}
+		if errors.Is(err, object.ErrFileNotFound) {
+			return c.notConfiguredError(kind)
+		}
+		return fmt.Errorf("failed to trigger app update: %v", err)
+	}
+
+	if c.Wait {
+		err = waitForRollout(c, response.PayloadID)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().Msg("Done!")
+
+	return nil
 }
 
-// Run deploys an app to Section's edge
-func (c *DeployCmd) Run(ctx *kong.Context, logWriters *LogWriters) (err error) {
+// notConfiguredError is returned when the environment repository has no module at --app-path to record the payload in
+func (c *DeployCmd) notConfiguredError(kind DeployKind) error {
+	return fmt.Errorf("this application is not configured to host a %s in the %s module on Section, or, possibly, you didn't specify the proper --app-path", kind.Description, c.AppPath)
+}
 
+// packageApp builds the app in --directory if --build is set, then validates and packages it,
+// writing the tarball to w. It returns the number of files and directories packaged, and the
+// SHA-256 of the tarball's uncompressed contents.
+func (c *DeployCmd) packageApp(w io.Writer, kind DeployKind, sc *SectionConfigJSON, logWriters *LogWriters) (packaged int, digest string, err error) {
 	dir := c.Directory
 	if dir == "." {
 		abs, err := filepath.Abs(dir)
@@ -61,110 +239,133 @@ func (c *DeployCmd) Run(ctx *kong.Context, logWriters *LogWriters) (err error) {
 		}
 	}
 
-	log.Info().Msg(Green("Deploying your node.js package to Account ID: %d, App ID: %d, Environment %s", c.AccountID, c.AppID, c.Environment))
-	if !c.SkipValidation {
-		errs := IsValidNodeApp(dir)
-		if len(errs) > 0 {
-			var se []string
-			for _, err := range errs {
-				se = append(se, fmt.Sprintf("- %s", err))
-			}
-			errstr := strings.Join(se, "\n")
-			return fmt.Errorf("not a valid Node.js app: \n\n%s", errstr)
+	if c.Build {
+		staging, err := c.buildApp(dir, logWriters)
+		if err != nil {
+			return 0, "", fmt.Errorf("failed to build app: %w", err)
 		}
+		if c.SkipDelete {
+			log.Info().Str("Directory", staging).Msg("Keeping build")
+		} else {
+			defer os.RemoveAll(staging)
+		}
+		dir = staging
 	}
 
 	s := NewSpinner(fmt.Sprintf("Packaging app in: %s", dir), logWriters)
 	s.Start()
 
-	ignores := []string{".lint", ".git"}
+	ignores := append([]string{}, kind.Ignores...)
+	fileIgnores, err := ReadIgnoreFile(dir)
+	if err != nil {
+		s.Stop()
+		return 0, "", fmt.Errorf("unable to read %s: %s", IgnoreFile, err)
+	}
+	ignores = append(ignores, fileIgnores...)
+	ignores = append(ignores, c.Ignore...)
 	files, err := BuildFilelist(dir, ignores)
 	if err != nil {
 		s.Stop()
-		return fmt.Errorf("unable to build file list: %s", err)
+		return 0, "", fmt.Errorf("unable to build file list: %s", err)
 	}
 	s.Stop()
+	if !c.SkipValidation {
+		err = c.validate(kind, sc, dir, files)
+		if err != nil {
+			return 0, "", err
+		}
+	}
 	log.Debug().Msg("Archiving files:")
 	for _, file := range files {
 		log.Debug().Str("file", file)
 	}
-
-	tempFile, err := ioutil.TempFile("", "sectionctl-deploy.*.tar.gz")
-	if err != nil {
-		s.Stop()
-		return fmt.Errorf("couldn't create a temp file: %v", err)
-	}
-	if c.SkipDelete {
-		s.Stop()
-		log.Debug().Str("Temporar upload tarball location", tempFile.Name())
-		s.Start()
-	} else {
-		defer os.Remove(tempFile.Name())
+	if c.ListFiles {
+		err = printFilelist(os.Stdout, files)
+		if err != nil {
+			return 0, "", err
+		}
 	}
 
-	err = CreateTarball(tempFile, files)
-	if err != nil {
-		s.Stop()
-		return fmt.Errorf("failed to pack files: %v", err)
-	}
+	s.Start()
+	digest, err = CreateTarball(w, files)
 	s.Stop()
-
-	log.Debug().Str("Temporar file location", tempFile.Name())
-	stat, err := tempFile.Stat()
 	if err != nil {
-		return fmt.Errorf("%s: could not stat, got error: %s", tempFile.Name(), err)
+		return 0, "", fmt.Errorf("failed to pack files: %v", err)
 	}
-	if stat.Size() > MaxFileSize {
-		return fmt.Errorf("failed to upload tarball: file size (%d) is greater than (%d)", stat.Size(), MaxFileSize)
+	log.Info().Str("SHA-256", digest).Msg("Packaged app")
+	return len(files) - 1, digest, nil
+}
+
+// upload sends the tarball at path to the upload service.
+//
+// Tarballs are sent in a single request, unless chunks are asked for with --upload chunked, or
+// with --upload auto for tarballs bigger than a chunk, falling back to a single request if the
+// service doesn't start a chunked upload.
+func (c *DeployCmd) upload(path string, size int64, digest string, progress *ProgressBar) (response UploadResponse, err error) {
+	chunked := c.UploadMode == uploadModeChunked ||
+		(c.UploadMode != uploadModeSingle && c.ChunkSizeMB > 0 && size > int64(c.ChunkSizeMB)*1024*1024)
+	if chunked {
+		response, err = newChunkedUploader(c, path, size, digest, progress).Upload()
+		if !errors.Is(err, errChunkedUploadNotStarted) || c.UploadMode == uploadModeChunked {
+			return response, err
+		}
+		log.Debug().Err(err).Msg("Falling back to uploading in a single request")
+		progress.Set(0)
 	}
 
-	_, err = tempFile.Seek(0, 0)
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("unable to seek to beginning of tarball: %s", err)
+		return response, err
 	}
-
-	req, err := newFileUploadRequest(c, tempFile)
+	req, err := newFileUploadRequest(c, f, size, digest, progress)
 	if err != nil {
-		return fmt.Errorf("unable to build file upload: %s", err)
+		return response, fmt.Errorf("unable to build file upload: %s", err)
 	}
 
 	req.Header.Add("section-token", api.Token)
 
 	log.Debug().Str("URL", req.URL.String())
 
-	artifactSizeMB := stat.Size() / 1024 / 1024
-	log.Debug().Msg(fmt.Sprintf("Upload artifact is %dMB (%d bytes) large", artifactSizeMB, stat.Size()))
-	s = NewSpinner(fmt.Sprintf("Uploading app (%dMB)...", artifactSizeMB), logWriters)
-	s.Start()
 	client := &http.Client{
 		Timeout: c.Timeout,
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("upload request failed: %v", err)
+		return response, fmt.Errorf("upload request failed: %v", err)
 	}
 	defer resp.Body.Close()
-	s.Stop()
 	if resp.StatusCode != 200 && resp.StatusCode != 204 {
-		return fmt.Errorf("upload failed with status: %s and transaction ID %s", resp.Status, resp.Header["Aperture-Tx-Id"][0])
+		return response, fmt.Errorf("upload failed with status: %s and transaction ID %s", resp.Status, resp.Header.Get("Aperture-Tx-Id"))
 	}
 
-	var response UploadResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return fmt.Errorf("failed to decode response %v", err)
+		return response, fmt.Errorf("failed to decode response %v", err)
 	}
+	return response, nil
+}
 
-	err = globalGitService.UpdateGitViaGit(ctx, c, response, logWriters)
+// validate runs the kind's validators against the files to be packaged, failing if any finds an
+// error. sc is the environment's section.config.json, or nil if it isn't known.
+func (c *DeployCmd) validate(kind DeployKind, sc *SectionConfigJSON, dir string, files []string) error {
+	vc := NewValidationContext(dir, files, c.AppPath)
+	vc.LargeFileSize = int64(c.LargeFileMB) * 1024 * 1024
+	vc.SectionConfig = sc
+	findings, err := RunValidators(vc, kind.Validators, c.SkipValidator)
 	if err != nil {
-		if err.Error() == "file not found" {
-			return fmt.Errorf("this application is not configured to host a node.js app on Section, or, possibly, you didn't specify the proper --AppPath")
+		return err
+	}
+	var errs []string
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errs = append(errs, fmt.Sprintf("- %s", f))
+			continue
 		}
-		return fmt.Errorf("failed to trigger app update: %v", err)
+		log.Warn().Str("Validator", f.Validator).Msg(f.Message)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("not a valid %s: \n\n%s\n\nSkip a check with --skip-validator NAME, or all checks with --skip-validation", kind.Description, strings.Join(errs, "\n"))
 	}
-
-	log.Info().Msg("Done!")
-
 	return nil
 }
 
@@ -207,7 +408,35 @@ func Split(r rune) bool {
 	return r == '\\' || r == '/'
 }
 
+// IgnoreFile is the name of the file listing patterns to exclude from a deploy, using .gitignore syntax
+const IgnoreFile = ".sectionignore"
+
+// DefaultIgnores are always excluded from a deploy, before patterns from the ignore file and flags are applied
+var DefaultIgnores = []string{".lint", ".git"}
+
+// ReadIgnoreFile returns the patterns in dir's .sectionignore, if it has one.
+func ReadIgnoreFile(dir string) (patterns []string, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return patterns, nil
+		}
+		return patterns, err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "#") || len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
 // BuildFilelist builds a list of files to be tarballed, with optional ignores.
+//
+// Ignores are patterns with the same semantics as .gitignore, including negation
+// with a leading "!". Later patterns take precedence over earlier ones.
 func BuildFilelist(dir string, ignores []string) (files []string, err error) {
 	var fi os.FileInfo
 	if fi, err = os.Stat(dir); os.IsNotExist(err) {
@@ -217,14 +446,28 @@ func BuildFilelist(dir string, ignores []string) (files []string, err error) {
 		return files, fmt.Errorf("specified path is not a directory: %s", dir)
 	}
 
+	var patterns []gitignore.Pattern
+	for _, i := range ignores {
+		if strings.HasPrefix(i, "#") || len(strings.TrimSpace(i)) == 0 {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(i, nil))
+	}
+	matcher := gitignore.NewMatcher(patterns)
+
 	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		for _, i := range ignores {
-			location := strings.FieldsFunc(path, Split) // split by subdirectory or filename
-			for _, loc := range location {
-				if strings.Contains(loc, i) {
-					return nil
-				}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && matcher.Match(strings.FieldsFunc(rel, Split), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 		files = append(files, path)
 		return nil
@@ -235,23 +478,65 @@ func BuildFilelist(dir string, ignores []string) (files []string, err error) {
 	return files, err
 }
 
-// CreateTarball creates a tarball containing all the files in filePaths and writes it to w.
-func CreateTarball(w io.Writer, filePaths []string) error {
-	gzipWriter := gzip.NewWriter(w)
-	defer gzipWriter.Close()
+// printFilelist writes the paths of files relative to the app directory, one per line.
+//
+// The first entry in files is the app directory itself and is skipped.
+func printFilelist(w io.Writer, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	prefix := files[0]
+	for _, f := range files[1:] {
+		rel, err := filepath.Rel(prefix, f)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi, err := os.Stat(f); err == nil && fi.IsDir() {
+			rel += "/"
+		}
+		fmt.Fprintln(w, rel)
+	}
+	return nil
+}
 
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
+// tarballModTime is the modification time recorded for every file in a tarball
+var tarballModTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// CreateTarball creates a tarball containing all the files in filePaths and writes it to w,
+// returning the SHA-256 of its uncompressed contents.
+//
+// Entries are sorted, and their times, owners and modes normalized, so the same files always
+// produce the same tarball and digest.
+func CreateTarball(w io.Writer, filePaths []string) (digest string, err error) {
+	gzipWriter := gzip.NewWriter(w)
+	hash := sha256.New()
+	tarWriter := tar.NewWriter(io.MultiWriter(gzipWriter, hash))
 
 	prefix := filePaths[0]
-	for _, filePath := range filePaths {
+	sorted := append([]string{}, filePaths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return tarName(sorted[i], prefix) < tarName(sorted[j], prefix)
+	})
+	for _, filePath := range sorted {
 		err := addFileToTarWriter(filePath, tarWriter, prefix)
 		if err != nil {
-			return fmt.Errorf(fmt.Sprintf("Could not add file '%s', to tarball, got error '%s'", filePath, err.Error()))
+			return "", fmt.Errorf(fmt.Sprintf("Could not add file '%s', to tarball, got error '%s'", filePath, err.Error()))
 		}
 	}
 
-	return nil
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tarName is the name of filePath in a tarball of the directory prefix
+func tarName(filePath string, prefix string) string {
+	return filepath.ToSlash(strings.TrimPrefix(filePath, prefix))
 }
 
 func addFileToTarWriter(filePath string, tarWriter *tar.Writer, prefix string) error {
@@ -281,7 +566,8 @@ func addFileToTarWriter(filePath string, tarWriter *tar.Writer, prefix string) e
 
 	// must provide real name
 	// (see https://golang.org/src/archive/tar/common.go?#L626)
-	header.Name = filepath.ToSlash(baseFilePath)
+	header.Name = tarName(filePath, prefix)
+	normalizeTarHeader(header)
 	// ensure windows provides filemodes for binaries in node_modules/.bin
 	if runtime.GOOS == "windows" {
 		match := strings.Contains(baseFilePath, "node_modules\\.bin")
@@ -304,44 +590,101 @@ func addFileToTarWriter(filePath string, tarWriter *tar.Writer, prefix string) e
 	return nil
 }
 
-// newFileUploadRequest builds a HTTP request for uploading an app and the account + app it belongs to
-func newFileUploadRequest(c *DeployCmd, f *os.File) (r *http.Request, err error) {
-	contents, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
+// normalizeTarHeader removes everything from a header that depends on where and when the
+// tarball is made, rather than on the files in it.
+func normalizeTarHeader(h *tar.Header) {
+	h.ModTime = tarballModTime
+	h.AccessTime = time.Time{}
+	h.ChangeTime = time.Time{}
+	h.Uid, h.Gid = 0, 0
+	h.Uname, h.Gname = "", ""
+	h.PAXRecords = nil
+	switch {
+	case h.Typeflag == tar.TypeDir:
+		h.Mode = 0o755
+	case h.Typeflag == tar.TypeSymlink:
+		h.Mode = 0o777
+	case h.Mode&0o111 != 0:
+		h.Mode = 0o755
+	default:
+		h.Mode = 0o644
 	}
-	defer f.Close()
+}
+
+// newFileUploadRequest builds a HTTP request for uploading an app, its digest, and the account + app it belongs to
+//
+// The multipart body is streamed from f as the request is sent, so the tarball is never held in memory.
+// If progress is not nil, it is advanced as the tarball is read.
+func newFileUploadRequest(c *DeployCmd, f *os.File, size int64, digest string, progress *ProgressBar) (r *http.Request, err error) {
+	boundary := multipart.NewWriter(nil).Boundary()
 
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-	part, err := writer.CreateFormFile("file", filepath.Base(f.Name()))
+	// Work out the size of the multipart framing so the upload has a Content-Length
+	var overhead countingWriter
+	err = writeUploadBody(&overhead, boundary, c, filepath.Base(f.Name()), digest, strings.NewReader(""))
 	if err != nil {
 		return nil, err
 	}
-	_, err = part.Write(contents)
+
+	var contents io.Reader = f
+	if progress != nil {
+		contents = progress.Reader(f)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer f.Close()
+		pw.CloseWithError(writeUploadBody(pw, boundary, c, filepath.Base(f.Name()), digest, contents))
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, c.ServerURL.String(), pr)
 	if err != nil {
-		return nil, err
+		pr.Close()
+		return nil, fmt.Errorf("failed to create upload URL: %v", err)
 	}
+	req.ContentLength = int64(overhead) + size
+	req.Header.Add("Content-Type", "multipart/form-data; boundary="+boundary)
 
-	err = writer.WriteField("account_id", strconv.Itoa(c.AccountID))
+	return req, err
+}
+
+// writeUploadBody writes the multipart form for an upload to w, copying the tarball from contents.
+func writeUploadBody(w io.Writer, boundary string, c *DeployCmd, filename string, digest string, contents io.Reader) (err error) {
+	writer := multipart.NewWriter(w)
+	err = writer.SetBoundary(boundary)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	err = writer.WriteField("app_id", strconv.Itoa(c.AppID))
+	part, err := writer.CreateFormFile("file", filename)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	err = writer.Close()
+	_, err = io.Copy(part, contents)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.ServerURL.String(), &body)
+	err = writer.WriteField("account_id", strconv.Itoa(c.AccountID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create upload URL: %v", err)
+		return err
+	}
+	err = writer.WriteField("app_id", strconv.Itoa(c.AppID))
+	if err != nil {
+		return err
+	}
+	if digest != "" {
+		err = writer.WriteField("sha256", digest)
+		if err != nil {
+			return err
+		}
 	}
-	req.Header.Add("Content-Type", writer.FormDataContentType())
 
-	return req, err
+	return writer.Close()
+}
+
+// countingWriter discards everything written to it, keeping count of the bytes
+type countingWriter int64
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	*cw += countingWriter(len(p))
+	return len(p), nil
 }
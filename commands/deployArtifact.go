@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeployPackageCmd packages an app into a tarball, using the flags on DeployCmd
+type DeployPackageCmd struct {
+	Out string `required:"" type:"path" help:"File to write the tarball to."`
+}
+
+// Run executes the command
+func (p *DeployPackageCmd) Run(logWriters *LogWriters, c *DeployCmd) (err error) {
+	sc := c.lookupEnvironmentConfig(logWriters)
+	kind, err := c.resolveKind(sc)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(p.Out)
+	if err != nil {
+		return fmt.Errorf("couldn't create %s: %w", p.Out, err)
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(p.Out)
+		}
+	}()
+	packaged, digest, err := c.packageApp(out, kind, sc, logWriters)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return fmt.Errorf("failed to pack files: %v", err)
+	}
+
+	stat, err := os.Stat(p.Out)
+	if err != nil {
+		return fmt.Errorf("%s: could not stat, got error: %s", p.Out, err)
+	}
+	if stat.Size() > MaxFileSize {
+		return fmt.Errorf("tarball is too large to deploy: file size (%d) is greater than (%d)", stat.Size(), MaxFileSize)
+	}
+	log.Info().Str("Artifact", p.Out).Str("SHA-256", digest).Msg(fmt.Sprintf("Packaged %d files and directories of your %s into %s", packaged, kind.Description, formatBytes(stat.Size())))
+	return nil
+}
+
+// ReadArtifact checks that the tarball at path can be deployed as a kind of module: that it's
+// a gzipped tarball no bigger than MaxFileSize, with no entries outside the app, and with the
+// kind's Contents at its root.
+//
+// It returns the SHA-256 of the tarball's uncompressed contents, which matches the digest from
+// CreateTarball, and the number of files and directories in it.
+func ReadArtifact(path string, kind DeployKind) (digest string, entries int, err error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if stat.Size() > MaxFileSize {
+		return "", 0, fmt.Errorf("file size (%d) is greater than (%d)", stat.Size(), MaxFileSize)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s is not a gzipped tarball: %v", path, err)
+	}
+	hash := sha256.New()
+	contents := io.TeeReader(gz, hash)
+	tr := tar.NewReader(contents)
+
+	root := map[string]bool{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("%s is not a valid tarball: %v", path, err)
+		}
+		name := strings.Trim(strings.TrimPrefix(h.Name, "./"), "/")
+		if name == "" || name == "." {
+			continue
+		}
+		for _, part := range strings.Split(name, "/") {
+			if part == ".." {
+				return "", 0, fmt.Errorf("%s is outside the app", h.Name)
+			}
+		}
+		entries++
+		top := strings.SplitN(name, "/", 2)
+		if len(top) > 1 || h.Typeflag == tar.TypeDir {
+			root[top[0]+"/"] = true
+		} else {
+			root[top[0]] = true
+		}
+	}
+	// the digest covers the whole stream, including the end of the archive
+	_, err = io.Copy(io.Discard, contents)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s is not a valid tarball: %v", path, err)
+	}
+
+	var missing []string
+	for _, want := range kind.Contents {
+		if !root[want] {
+			missing = append(missing, want)
+		}
+	}
+	if len(missing) > 0 {
+		return "", 0, fmt.Errorf("%s is missing at the root of the tarball", strings.Join(missing, ", "))
+	}
+	return hex.EncodeToString(hash.Sum(nil)), entries, nil
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func helperArtifact(t *testing.T, names ...string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		h := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+		if name[len(name)-1] == '/' {
+			h.Typeflag = tar.TypeDir
+			h.Mode = 0755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	path := filepath.Join(t.TempDir(), "app.tar.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommandsDeployReadArtifactChecksStructure(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		kind    string
+		entries []string
+		err     string
+	}{
+		{"node.js app", "nodejs", []string{"package.json", "node_modules/", "node_modules/dep/index.js"}, ""},
+		{"relative paths", "nodejs", []string{"./", "./package.json", "./node_modules/dep/index.js"}, ""},
+		{"missing node_modules", "nodejs", []string{"package.json", "app.js"}, "node_modules/ is missing"},
+		{"app in a subdirectory", "nodejs", []string{"app/package.json", "app/node_modules/"}, "package.json, node_modules/ is missing"},
+		{"outside the app", "nodejs", []string{"package.json", "node_modules/", "../../etc/passwd"}, "outside the app"},
+		{"static site", "static", []string{"index.html", "css/site.css"}, ""},
+		{"static site without index", "static", []string{"about.html"}, "index.html is missing"},
+		{"generic", "generic", []string{"anything"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			path := helperArtifact(t, tc.entries...)
+			kind, err := FindDeployKind(tc.kind)
+			assert.NoError(err)
+
+			// Invoke
+			digest, _, err := ReadArtifact(path, kind)
+
+			// Test
+			if tc.err != "" {
+				if assert.Error(err) {
+					assert.Contains(err.Error(), tc.err)
+				}
+				return
+			}
+			assert.NoError(err)
+			assert.Len(digest, 64)
+		})
+	}
+}
+
+func TestCommandsDeployReadArtifactRejectsOtherFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := filepath.Join(t.TempDir(), "app.tar.gz")
+	assert.NoError(ioutil.WriteFile(path, []byte(`{"not": "a tarball"}`), 0644))
+	kind, _ := FindDeployKind("generic")
+
+	// Invoke
+	_, _, err := ReadArtifact(path, kind)
+
+	// Test
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "not a gzipped tarball")
+	}
+}
+
+func TestCommandsDeployPackageThenDeployArtifact(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var uploaded []byte
+	var uploadedDigest string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			file, _, err := r.FormFile("file")
+			assert.NoError(err)
+			uploaded, _ = ioutil.ReadAll(file)
+			uploadedDigest = r.FormValue("sha256")
+			fmt.Fprint(w, string(helperLoadBytes(t, "deploy/upload.response.with_success.json")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	url, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = url
+	api.MaxAttempts = 1
+
+	dir := filepath.Join("testdata", "deploy", "valid-nodejs-app")
+	paths, err := BuildFilelist(dir, DefaultIgnores)
+	assert.NoError(err)
+	digest, err := CreateTarball(io.Discard, paths)
+	assert.NoError(err)
+
+	artifact := filepath.Join(t.TempDir(), "app.tar.gz")
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	mockGit := MockGitService{}
+	globalGitService = &mockGit
+
+	// Invoke
+	packageErr := (&DeployPackageCmd{Out: artifact}).Run(&logWriters, &DeployCmd{Directory: dir, Kind: "nodejs"})
+	c := DeployCmd{Directory: "does-not-exist", Artifact: artifact, ServerURL: url, AccountID: 100, AppID: 200, Environment: "dev", Kind: "nodejs"}
+	deployErr := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	assert.NoError(packageErr)
+	assert.NoError(deployErr)
+	contents, err := ioutil.ReadFile(artifact)
+	assert.NoError(err)
+	assert.Equal(contents, uploaded, "the artifact is uploaded as it is")
+	assert.Equal(digest, uploadedDigest, "the artifact has the same digest as packaging the app")
+	assert.True(mockGit.Called)
+	_, err = os.Stat(artifact)
+	assert.NoError(err, "the artifact is kept")
+}
+
+func TestCommandsDeployArtifactCantBeBuilt(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := helperArtifact(t, "package.json", "node_modules/")
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := DeployCmd{Artifact: path, Kind: "nodejs", Build: true, DryRun: true}
+
+	// Invoke
+	err := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "--build")
+	}
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// npmCommand is the npm executable used to build apps
+var npmCommand = "npm"
+
+// buildIgnores are left out of the staging copy an app is built in, so it is built from clean
+var buildIgnores = append(append([]string{}, DefaultIgnores...), "/node_modules/")
+
+// buildApp copies the app in dir to a staging directory, installs its dependencies, runs its
+// build script with NODE_ENV=production, and prunes its devDependencies. It returns the
+// staging directory, which the caller must remove.
+//
+// The build script is named by section.build in package.json, falling back to build.
+func (c *DeployCmd) buildApp(dir string, logWriters *LogWriters) (staging string, err error) {
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return "", fmt.Errorf("unable to read package.json to build the app: %w", err)
+	}
+	packageJSON, err := ParsePackageJSON(string(contents))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse package.json to build the app: %w", err)
+	}
+	script := packageJSON.Section.Build
+	if script == "" {
+		script = "build"
+	}
+	if packageJSON.Scripts[script] == "" {
+		return "", fmt.Errorf("package.json does not include the build script: %s", script)
+	}
+
+	staging, err = ioutil.TempDir("", "sectionctl-build-*")
+	if err != nil {
+		return "", fmt.Errorf("couldn't create a staging directory: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(staging)
+		}
+	}()
+	files, err := BuildFilelist(dir, buildIgnores)
+	if err != nil {
+		return "", fmt.Errorf("unable to build file list: %w", err)
+	}
+	err = copyFiles(files, staging)
+	if err != nil {
+		return "", fmt.Errorf("unable to copy the app to %s: %w", staging, err)
+	}
+	log.Info().Str("Directory", staging).Msg("Building app")
+
+	install := []string{"install"}
+	if _, err := os.Stat(filepath.Join(staging, "package-lock.json")); err == nil {
+		install = []string{"ci"}
+	}
+	// devDependencies are needed to build, so they're installed before NODE_ENV is set
+	steps := []struct {
+		args       []string
+		production bool
+	}{
+		{install, false},
+		{[]string{"run", script}, true},
+		{[]string{"prune", "--production"}, true},
+	}
+	for _, step := range steps {
+		err = runBuildStep(staging, step.args, step.production, logWriters.CarriageReturnWriter)
+		if err != nil {
+			return "", err
+		}
+	}
+	return staging, nil
+}
+
+// runBuildStep runs npm with args in dir, streaming its output to out
+func runBuildStep(dir string, args []string, production bool, out io.Writer) error {
+	log.Info().Msg(fmt.Sprintf("Running: %s %s", npmCommand, strings.Join(args, " ")))
+	cmd := exec.Command(npmCommand, args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "NODE_ENV=") {
+			cmd.Env = append(cmd.Env, e)
+		}
+	}
+	if production {
+		cmd.Env = append(cmd.Env, "NODE_ENV=production")
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w", npmCommand, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// copyFiles copies files, as returned by BuildFilelist, into dst, keeping their modes and symlinks
+func copyFiles(files []string, dst string) error {
+	prefix := files[0]
+	for _, f := range files[1:] {
+		rel, err := filepath.Rel(prefix, f)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		fi, err := os.Lstat(f)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			err = os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			var link string
+			link, err = os.Readlink(f)
+			if err == nil {
+				err = os.Symlink(link, target)
+			}
+		default:
+			err = copyFile(f, target, fi.Mode().Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
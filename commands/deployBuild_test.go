@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNPM stands in for npm, recording how it was run and faking an install, build and prune
+const fakeNPM = `#!/bin/sh
+echo "$* NODE_ENV=$NODE_ENV" >> "$FAKE_NPM_LOG"
+echo "npm $1 output"
+case "$1" in
+install|ci) mkdir -p node_modules/dep node_modules/devdep ;;
+run) mkdir -p dist && echo "built" > dist/app.js ;;
+prune) rm -rf node_modules/devdep ;;
+esac
+`
+
+func helperFakeNPM(t *testing.T) (logPath string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake npm is a shell script")
+	}
+	dir := t.TempDir()
+	npm := filepath.Join(dir, "npm")
+	if err := ioutil.WriteFile(npm, []byte(fakeNPM), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath = filepath.Join(dir, "npm.log")
+	os.Setenv("FAKE_NPM_LOG", logPath)
+	old := npmCommand
+	npmCommand = npm
+	t.Cleanup(func() {
+		npmCommand = old
+		os.Unsetenv("FAKE_NPM_LOG")
+	})
+	return logPath
+}
+
+func TestCommandsDeployBuildRunsBuildScriptInStagingCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	npmLog := helperFakeNPM(t)
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"package.json":            `{"scripts": {"compile": "tsc", "start": "node dist/app.js"}, "section": {"build": "compile"}}`,
+		"package-lock.json":       `{}`,
+		"src/app.ts":              "console.log('hi')",
+		"node_modules/stale/x.js": "",
+		"node_modules/.bin/stale": "",
+		".git/HEAD":               "ref: refs/heads/main",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	var out bytes.Buffer
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: &out}
+	os.Setenv("NODE_ENV", "development")
+	defer os.Unsetenv("NODE_ENV")
+	c := DeployCmd{}
+
+	// Invoke
+	staging, err := c.buildApp(dir, &logWriters)
+
+	// Test
+	assert.NoError(err)
+	defer os.RemoveAll(staging)
+	for _, exists := range []string{"src/app.ts", "dist/app.js", "node_modules/dep"} {
+		_, err := os.Stat(filepath.Join(staging, exists))
+		assert.NoError(err, exists)
+	}
+	for _, missing := range []string{"node_modules/stale", "node_modules/devdep", ".git"} {
+		_, err := os.Stat(filepath.Join(staging, missing))
+		assert.True(os.IsNotExist(err), missing)
+	}
+	_, err = os.Stat(filepath.Join(dir, "dist"))
+	assert.True(os.IsNotExist(err), "the source directory is left alone")
+
+	runs, err := ioutil.ReadFile(npmLog)
+	assert.NoError(err)
+	assert.Equal([]string{
+		"ci NODE_ENV=",
+		"run compile NODE_ENV=production",
+		"prune --production NODE_ENV=production",
+	}, strings.Split(strings.TrimSpace(string(runs)), "\n"))
+	assert.Contains(out.String(), "npm run output")
+}
+
+func TestCommandsDeployBuildRequiresBuildScript(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	helperFakeNPM(t)
+	dir := t.TempDir()
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"scripts": {"start": "node app.js"}}`), 0644))
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := DeployCmd{}
+
+	// Invoke
+	_, err := c.buildApp(dir, &logWriters)
+
+	// Test
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "build script: build")
+	}
+}
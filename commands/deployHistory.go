@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeployHistoryCmd lists previous deploys of an app environment
+type DeployHistoryCmd struct {
+	Number int `short:"n" default:"10" help:"Number of deploys to show. 0 shows all."`
+}
+
+// Run executes the command
+func (h *DeployHistoryCmd) Run(cli *CLI, logWriters *LogWriters, c *DeployCmd) (err error) {
+	if c.AppPath == "" {
+		if _, err := c.resolveKind(c.lookupEnvironmentConfig(logWriters)); err != nil {
+			return err
+		}
+	}
+	history, err := globalGitService.PayloadHistory(c, logWriters)
+	if err != nil {
+		return fmt.Errorf("unable to look up deploy history: %w", err)
+	}
+	if h.Number > 0 && len(history) > h.Number {
+		history = history[:h.Number]
+	}
+
+	if ok, err := WriteStructured(cli, os.Stdout, history); ok {
+		return err
+	}
+
+	table := NewTable(cli, os.Stdout)
+	table.SetHeader([]string{"", "Date", "Commit", "Author", "Payload ID", "Source"})
+	for i, e := range history {
+		var current string
+		if i == 0 {
+			current = "*"
+		}
+		r := []string{
+			current,
+			e.When.Format("2006-01-02 15:04:05 -0700"),
+			fmt.Sprintf("%.7s", e.Commit),
+			fmt.Sprintf("%s <%s>", e.AuthorName, e.AuthorEmail),
+			e.PayloadID,
+			historySource(e),
+		}
+		table.Append(r)
+	}
+	table.Render()
+	return nil
+}
+
+// historySource describes the source commit and branch a deploy was made from, if it was recorded
+func historySource(e PayloadHistoryEntry) string {
+	source := fmt.Sprintf("%.7s", e.Trailers[trailerSourceCommit])
+	if branch := e.Trailers[trailerSourceBranch]; branch != "" {
+		source = strings.TrimSpace(source + " (" + branch + ")")
+	}
+	return source
+}
+
+// DeployRollbackCmd redeploys an earlier payload to an app environment
+type DeployRollbackCmd struct {
+	PayloadID string `help:"Payload ID to roll back to. Defaults to the payload deployed before the current one. See 'deploy history'."`
+}
+
+// Run executes the command
+func (r *DeployRollbackCmd) Run(logWriters *LogWriters, c *DeployCmd) (err error) {
+	if c.AppPath == "" {
+		if _, err := c.resolveKind(c.lookupEnvironmentConfig(logWriters)); err != nil {
+			return err
+		}
+	}
+	log.Info().Msg(Green("Rolling back Account ID: %d, App ID: %d, Environment %s", c.AccountID, c.AppID, c.Environment))
+	target, err := globalGitService.Rollback(c, r.PayloadID, logWriters)
+	if err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	log.Info().Str("Payload ID", target.PayloadID).Str("Originally deployed", target.When.Format("2006-01-02 15:04:05 -0700")).Msg("Rolled back")
+	if c.Wait {
+		return waitForRollout(c, target.PayloadID)
+	}
+	return nil
+}
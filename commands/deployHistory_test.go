@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func helperCommitPayload(t *testing.T, r *git.Repository, dir, payloadID string, when time.Time) {
+	path := filepath.Join(dir, "nodejs", ".section-external-source.json")
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(path, []byte(`{"section_payload_id": "`+payloadID+`"}`), 0644)
+	assert.NoError(t, err)
+	w, err := r.Worktree()
+	assert.NoError(t, err)
+	_, err = w.Add("nodejs/.section-external-source.json")
+	assert.NoError(t, err)
+	_, err = w.Commit("deploy "+payloadID, &git.CommitOptions{Author: &object.Signature{Name: "Ada", Email: "ada@lovelace.example", When: when}})
+	assert.NoError(t, err)
+}
+
+func TestCommandsDeployPayloadHistoryListsPayloadsMostRecentFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir, err := ioutil.TempDir("", "sectionctl-history")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	r, err := git.PlainInit(dir, false)
+	assert.NoError(err)
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"one", "two", "three"} {
+		helperCommitPayload(t, r, dir, id, start.Add(time.Duration(i)*time.Hour))
+	}
+	// an unrelated commit should not show up in the history
+	err = ioutil.WriteFile(filepath.Join(dir, "section.config.json"), []byte("{}"), 0644)
+	assert.NoError(err)
+	w, err := r.Worktree()
+	assert.NoError(err)
+	_, err = w.Add("section.config.json")
+	assert.NoError(err)
+	_, err = w.Commit("config", &git.CommitOptions{Author: &object.Signature{Name: "Ada", Email: "ada@lovelace.example", When: start.Add(5 * time.Hour)}})
+	assert.NoError(err)
+
+	// Invoke
+	history, err := payloadHistory(r, "nodejs/.section-external-source.json")
+
+	// Test
+	assert.NoError(err)
+	if assert.Len(history, 3) {
+		assert.Equal("three", history[0].PayloadID)
+		assert.Equal("two", history[1].PayloadID)
+		assert.Equal("one", history[2].PayloadID)
+		assert.Equal("Ada", history[0].AuthorName)
+		assert.Equal("deploy three", history[0].Message)
+		assert.True(start.Add(2 * time.Hour).Equal(history[0].When))
+	}
+}
+
+func TestCommandsDeployRollbackTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	history := []PayloadHistoryEntry{
+		{Commit: "c4", PayloadID: "three"},
+		{Commit: "c3", PayloadID: "three"},
+		{Commit: "c2", PayloadID: "two"},
+		{Commit: "c1", PayloadID: "one"},
+	}
+	var testCases = []struct {
+		payloadID string
+		commit    string
+		err       bool
+	}{
+		{"", "c2", false},
+		{"one", "c1", false},
+		{"three", "", true},
+		{"missing", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.payloadID, func(t *testing.T) {
+			// Invoke
+			e, err := rollbackTarget(history, tc.payloadID)
+
+			// Test
+			if tc.err {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+				assert.Equal(tc.commit, e.Commit)
+			}
+		})
+	}
+
+	_, err := rollbackTarget(history[:2], "")
+	assert.Error(err)
+}
+
+func TestCommandsDeployCurrentPayloadReadsHead(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	assert.NoError(err)
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	helperCommitPayload(t, r, dir, "one", start)
+	helperCommitPayload(t, r, dir, "two", start.Add(time.Hour))
+
+	// Invoke
+	pv, err := currentPayload(r, "nodejs/.section-external-source.json")
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("two", pv.ID)
+	assert.Empty(pv.SHA256)
+}
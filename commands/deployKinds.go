@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeployKind describes how to validate and package one kind of module
+type DeployKind struct {
+	// Name selects the kind with --kind
+	Name string
+	// Description says what is being deployed, in messages
+	Description string
+	// Module is the module the kind deploys to when --app-path isn't set.
+	// It is also the module's directory in the environment repository.
+	Module string
+	// Validators are the names of the validators run before packaging
+	Validators []string
+	// Ignores are excluded from the package, before patterns from the ignore file and flags
+	Ignores []string
+	// Contents must be at the root of a prebuilt artifact. Directories end in a slash.
+	Contents []string
+	// images matches the names of the Section images, without registry or tag, of modules in
+	// the proxychain that take this kind
+	images *regexp.Regexp
+}
+
+// DeployKinds are the kinds of module that can be deployed, in the order they are detected
+var DeployKinds = []DeployKind{
+	{
+		Name:        "nodejs",
+		Description: "node.js app",
+		Module:      "nodejs",
+		Validators:  []string{"node-app", "entry-file", "node-engine", "native-addons", "dev-dependencies", "symlinks", "file-size"},
+		Ignores:     DefaultIgnores,
+		Contents:    []string{"package.json", "node_modules/"},
+		images:      regexp.MustCompile(`^nodejs(-basic|-\d+(\.\d+)*)?$`),
+	},
+	{
+		Name:        "static",
+		Description: "static site",
+		Module:      "static",
+		Validators:  []string{"static-site", "symlinks", "file-size"},
+		Ignores:     append(append([]string{}, DefaultIgnores...), "node_modules/"),
+		Contents:    []string{"index.html"},
+		images:      regexp.MustCompile(`^(static|nginx)(-\d+(\.\d+)*)?$`),
+	},
+	{
+		Name:        "generic",
+		Description: "package",
+		Validators:  []string{"symlinks", "file-size"},
+		Ignores:     DefaultIgnores,
+	},
+}
+
+// FindDeployKind returns the named kind
+func FindDeployKind(name string) (DeployKind, error) {
+	var names []string
+	for _, k := range DeployKinds {
+		if k.Name == name {
+			return k, nil
+		}
+		names = append(names, k.Name)
+	}
+	return DeployKind{}, fmt.Errorf("unknown deploy kind %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// deployKindForImage returns the kind of module running image, falling back to generic
+func deployKindForImage(image string) DeployKind {
+	name := image
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name = image[:i]
+	}
+	name = name[strings.LastIndex(name, "/")+1:]
+	for _, k := range DeployKinds {
+		if k.images != nil && k.images.MatchString(name) {
+			return k
+		}
+	}
+	k, _ := FindDeployKind("generic")
+	return k
+}
+
+// resolveKind works out what is being deployed, and to which module, setting c.AppPath.
+//
+// --kind and --app-path win when set. Otherwise they are detected from the proxychain in the
+// environment's section.config.json, sc: --app-path picks the module by name, and its image
+// sets the kind; without --app-path the first node.js or static module is used. When sc is nil,
+// or has no such module, a node.js app is assumed, with a warning.
+func (c *DeployCmd) resolveKind(sc *SectionConfigJSON) (k DeployKind, err error) {
+	if c.Kind != "" {
+		k, err = FindDeployKind(c.Kind)
+		if err != nil {
+			return k, err
+		}
+		if c.AppPath == "" {
+			c.AppPath = k.Module
+		}
+		if c.AppPath == "" {
+			return k, fmt.Errorf("--app-path is required to deploy a %s", k.Description)
+		}
+		return k, nil
+	}
+
+	var proxychain []ProxychainModule
+	if sc != nil {
+		proxychain = sc.Proxychain
+	}
+	if c.AppPath != "" {
+		for _, m := range proxychain {
+			if m.Name == c.AppPath {
+				return deployKindForImage(m.Image), nil
+			}
+		}
+		if sc != nil {
+			log.Warn().Str("Module", c.AppPath).Msg("Module not found in the environment's proxychain, assuming it is a node.js app. Set --kind if it isn't.")
+		} else {
+			log.Warn().Str("Module", c.AppPath).Msg("Unable to read the environment's proxychain, assuming the module is a node.js app. Set --kind if it isn't.")
+		}
+		return FindDeployKind("nodejs")
+	}
+
+	for _, m := range proxychain {
+		if k := deployKindForImage(m.Image); k.Module != "" {
+			log.Debug().Str("Module", m.Name).Str("Image", m.Image).Str("Kind", k.Name).Msg("Detected module to deploy to")
+			c.AppPath = m.Name
+			return k, nil
+		}
+	}
+	k, err = FindDeployKind("nodejs")
+	c.AppPath = k.Module
+	if sc != nil {
+		log.Warn().Msg("No node.js or static module found in the environment's proxychain, assuming a node.js app in the nodejs module. Set --kind and --app-path if it isn't.")
+	} else {
+		log.Warn().Msg("Unable to read the environment's proxychain, assuming a node.js app in the nodejs module. Set --kind and --app-path if it isn't.")
+	}
+	return k, err
+}
+
+// environmentConfig reads the environment's section.config.json from target, returning nil if it can't
+func environmentConfig(target DeployTarget) *SectionConfigJSON {
+	sc, err := target.SectionConfig()
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to read the environment's section.config.json")
+		return nil
+	}
+	if sc == nil {
+		log.Warn().Msg("The environment has no section.config.json")
+	}
+	return sc
+}
+
+// lookupEnvironmentConfig clones the environment repository to read its section.config.json,
+// for commands that don't otherwise need the clone. It returns nil if it can't.
+func (c *DeployCmd) lookupEnvironmentConfig(logWriters *LogWriters) *SectionConfigJSON {
+	if c.GitRemote == "" && (c.AccountID == 0 || c.AppID == 0) {
+		log.Debug().Msg("No account or app given, so not reading the environment's section.config.json")
+		return nil
+	}
+	target, err := globalGitService.OpenDeploy(c, logWriters)
+	if err != nil {
+		log.Warn().Err(err).Msg("Unable to clone the environment repository to read its section.config.json")
+		return nil
+	}
+	defer target.Close()
+	return environmentConfig(target)
+}
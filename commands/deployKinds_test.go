@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsDeployKindsDetectedFromImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		image string
+		kind  string
+	}{
+		{"gcr.io/section-io/nodejs:14.17.0", "nodejs"},
+		{"nodejs-basic:12", "nodejs"},
+		{"nodejs-1.0.0", "nodejs"},
+		{"node:14-alpine", "generic"},
+		{"example/nodeapp-proxy:1", "generic"},
+		{"static:1.0", "static"},
+		{"nginx", "static"},
+		{"openresty-nginx:1.19", "generic"},
+		{"varnish:6.0", "generic"},
+		{"registry:5000/custom/app:1.2", "generic"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			// Invoke
+			k := deployKindForImage(tc.image)
+
+			// Test
+			assert.Equal(tc.kind, k.Name)
+		})
+	}
+}
+
+func TestCommandsDeployResolvesKindAndModule(t *testing.T) {
+	assert := assert.New(t)
+
+	sc := &SectionConfigJSON{Proxychain: []ProxychainModule{
+		{Name: "varnish", Image: "varnish:6.0"},
+		{Name: "site", Image: "static:1.0"},
+		{Name: "custom", Image: "example/custom:2"},
+	}}
+	var testCases = []struct {
+		name    string
+		kind    string
+		appPath string
+		sc      *SectionConfigJSON
+		want    string
+		module  string
+		err     bool
+	}{
+		{"kind flag uses its module", "static", "", sc, "static", "static", false},
+		{"kind flag keeps app path", "nodejs", "api", sc, "nodejs", "api", false},
+		{"generic needs an app path", "generic", "", sc, "generic", "", true},
+		{"app path picks module from proxychain", "", "custom", sc, "generic", "custom", false},
+		{"detects first deployable module", "", "", sc, "static", "site", false},
+		{"falls back to nodejs without section.config.json", "", "", nil, "nodejs", "nodejs", false},
+		{"unknown app path falls back to nodejs", "", "other", sc, "nodejs", "other", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Setup
+			c := DeployCmd{Kind: tc.kind, AppPath: tc.appPath}
+
+			// Invoke
+			k, err := c.resolveKind(tc.sc)
+
+			// Test
+			if tc.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.want, k.Name)
+			assert.Equal(tc.module, c.AppPath)
+		})
+	}
+}
+
+func TestCommandsDeployStaticSiteUsesItsOwnValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "about.html"), []byte("<h1>About</h1>"), 0644))
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := DeployCmd{Directory: dir, Kind: "static", DryRun: true}
+
+	// Invoke
+	missingIndex := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+	assert.NoError(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Home</h1>"), 0644))
+	withIndex := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	if assert.Error(missingIndex) {
+		assert.Contains(missingIndex.Error(), "not a valid static site")
+		assert.Contains(missingIndex.Error(), "index.html")
+	}
+	assert.NoError(withIndex)
+	assert.Equal("static", c.AppPath)
+}
+
+func TestCommandsDeployDetectsKindFromEnvironmentConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>Home</h1>"), 0644))
+	globalGitService = &MockGitService{Config: &SectionConfigJSON{Proxychain: []ProxychainModule{
+		{Name: "varnish", Image: "varnish:6.0"},
+		{Name: "site", Image: "static:1.0"},
+	}}}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := DeployCmd{Directory: dir, AccountID: 1, AppID: 2, Environment: "dev", DryRun: true}
+
+	// Invoke
+	err := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("site", c.AppPath)
+}
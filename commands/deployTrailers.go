@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/version"
+)
+
+// Trailers recorded in deploy commits, so what is live can be traced back to the code it came from
+const (
+	trailerSourceCommit = "Source-Commit"
+	trailerSourceBranch = "Source-Branch"
+	trailerCIJobURL     = "CI-Job-URL"
+	trailerVersion      = "Sectionctl-Version"
+	trailerPayloadHash  = "Payload-SHA256"
+)
+
+// trailerOrder is the order trailers are written in
+var trailerOrder = []string{trailerSourceCommit, trailerSourceBranch, trailerCIJobURL, trailerVersion, trailerPayloadHash}
+
+// ciEnv lists the environment variables CI services set, most specific first
+var ciEnv = struct {
+	commit []string
+	branch []string
+	jobURL []string
+}{
+	commit: []string{"GITHUB_SHA", "CI_COMMIT_SHA", "CIRCLE_SHA1", "BUILDKITE_COMMIT", "TRAVIS_COMMIT", "BITBUCKET_COMMIT", "BUILD_SOURCEVERSION", "GIT_COMMIT"},
+	branch: []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "CIRCLE_BRANCH", "BUILDKITE_BRANCH", "TRAVIS_BRANCH", "BITBUCKET_BRANCH", "BUILD_SOURCEBRANCHNAME", "GIT_BRANCH"},
+	jobURL: []string{"CI_JOB_URL", "CIRCLE_BUILD_URL", "BUILDKITE_BUILD_URL", "TRAVIS_JOB_WEB_URL", "BUILD_URL"},
+}
+
+// deployTrailers returns the trailers for a deploy of the app in c.Directory, as a package
+// with the given digest. Source details come from the directory's git repository, falling back
+// to the CI service's environment variables.
+func deployTrailers(c *DeployCmd, digest string) map[string]string {
+	trailers := map[string]string{trailerVersion: version.Version}
+	if digest != "" {
+		trailers[trailerPayloadHash] = digest
+	}
+
+	commit, branch := sourceRevision(c.Directory)
+	if commit == "" {
+		commit = firstEnv(ciEnv.commit)
+	}
+	if branch == "" {
+		branch = strings.TrimPrefix(firstEnv(ciEnv.branch), "origin/")
+	}
+	if commit != "" {
+		trailers[trailerSourceCommit] = commit
+	}
+	if branch != "" {
+		trailers[trailerSourceBranch] = branch
+	}
+	if u := ciJobURL(); u != "" {
+		trailers[trailerCIJobURL] = u
+	}
+	return trailers
+}
+
+// sourceRevision returns the commit and branch checked out in the git repository containing dir.
+// The branch is empty when HEAD is detached, as it usually is in CI.
+func sourceRevision(dir string) (commit string, branch string) {
+	r, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		log.Debug().Err(err).Str("Directory", dir).Msg("Unable to find the app's git repository")
+		return "", ""
+	}
+	head, err := r.Head()
+	if err != nil {
+		log.Debug().Err(err).Str("Directory", dir).Msg("Unable to read the app's git HEAD")
+		return "", ""
+	}
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	return head.Hash().String(), branch
+}
+
+// ciJobURL returns the URL of the CI job running sectionctl, if there is one
+func ciJobURL() string {
+	if server, repo, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"); server != "" && repo != "" && run != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, run)
+	}
+	if origin, build := os.Getenv("BITBUCKET_GIT_HTTP_ORIGIN"), os.Getenv("BITBUCKET_BUILD_NUMBER"); origin != "" && build != "" {
+		return fmt.Sprintf("%s/addon/pipelines/home#!/results/%s", origin, build)
+	}
+	if collection, project, build := os.Getenv("SYSTEM_COLLECTIONURI"), os.Getenv("SYSTEM_TEAMPROJECT"), os.Getenv("BUILD_BUILDID"); collection != "" && project != "" && build != "" {
+		return fmt.Sprintf("%s%s/_build/results?buildId=%s", collection, project, build)
+	}
+	return firstEnv(ciEnv.jobURL)
+}
+
+func firstEnv(names []string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// withTrailers appends trailers to a commit message, after a blank line
+func withTrailers(message string, trailers map[string]string) string {
+	var lines []string
+	for _, k := range trailerOrder {
+		if v, ok := trailers[k]; ok {
+			lines = append(lines, fmt.Sprintf("%s: %s", k, v))
+		}
+	}
+	if len(lines) == 0 {
+		return message
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// trailerLine matches a line of a commit message's trailers
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9-]+): (.*)$`)
+
+// parseTrailers splits the trailers from the end of a commit message
+func parseTrailers(message string) (body string, trailers map[string]string) {
+	message = strings.TrimSpace(message)
+	i := strings.LastIndex(message, "\n\n")
+	if i < 0 {
+		return message, nil
+	}
+	for _, line := range strings.Split(message[i+2:], "\n") {
+		m := trailerLine.FindStringSubmatch(line)
+		if m == nil {
+			return message, nil
+		}
+		if trailers == nil {
+			trailers = map[string]string{}
+		}
+		trailers[m[1]] = m[2]
+	}
+	return strings.TrimSpace(message[:i]), trailers
+}
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/section/sectionctl/api"
+	"github.com/section/sectionctl/version"
+	"github.com/stretchr/testify/assert"
+)
+
+// helperClearCIEnv unsets the environment variables CI services set, so tests run the same in CI
+func helperClearCIEnv(t *testing.T) {
+	names := append(append(append([]string{}, ciEnv.commit...), ciEnv.branch...), ciEnv.jobURL...)
+	names = append(names, "GITHUB_SERVER_URL", "GITHUB_REPOSITORY", "GITHUB_RUN_ID", "BITBUCKET_GIT_HTTP_ORIGIN", "BITBUCKET_BUILD_NUMBER", "SYSTEM_COLLECTIONURI", "SYSTEM_TEAMPROJECT", "BUILD_BUILDID")
+	for _, n := range names {
+		t.Setenv(n, "")
+	}
+}
+
+func TestCommandsDeployTrailersRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		message  string
+		trailers map[string]string
+	}{
+		{"Deploy the new checkout", map[string]string{trailerSourceCommit: "abc123", trailerVersion: "v1.2.3"}},
+		{"Deploy\n\nWith a longer description: of the change\nover two lines", map[string]string{trailerPayloadHash: "f00d"}},
+		{"No trailers", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.message, func(t *testing.T) {
+			// Invoke
+			body, trailers := parseTrailers(withTrailers(tc.message, tc.trailers))
+
+			// Test
+			assert.Equal(tc.message, body)
+			assert.Equal(tc.trailers, trailers)
+		})
+	}
+}
+
+func TestCommandsDeployTrailersFromSourceRepo(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	helperClearCIEnv(t)
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	assert.NoError(err)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644))
+	w, err := r.Worktree()
+	assert.NoError(err)
+	_, err = w.Add("package.json")
+	assert.NoError(err)
+	hash, err := w.Commit("app", &git.CommitOptions{Author: &object.Signature{Name: "Ada", Email: "ada@lovelace.example", When: time.Now()}})
+	assert.NoError(err)
+	t.Setenv("GITHUB_SERVER_URL", "https://github.com")
+	t.Setenv("GITHUB_REPOSITORY", "example/app")
+	t.Setenv("GITHUB_RUN_ID", "42")
+
+	// Invoke
+	trailers := deployTrailers(&DeployCmd{Directory: filepath.Join(dir, ".")}, "f00d")
+
+	// Test
+	assert.Equal(map[string]string{
+		trailerSourceCommit: hash.String(),
+		trailerSourceBranch: "master",
+		trailerCIJobURL:     "https://github.com/example/app/actions/runs/42",
+		trailerVersion:      version.Version,
+		trailerPayloadHash:  "f00d",
+	}, trailers)
+}
+
+func TestCommandsDeployTrailersFromCIEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	helperClearCIEnv(t)
+	t.Setenv("CI_COMMIT_SHA", "0123456789abcdef")
+	t.Setenv("CI_COMMIT_REF_NAME", "main")
+	t.Setenv("CI_JOB_URL", "https://gitlab.example/app/-/jobs/7")
+
+	// Invoke
+	trailers := deployTrailers(&DeployCmd{Directory: t.TempDir()}, "")
+
+	// Test
+	assert.Equal(map[string]string{
+		trailerSourceCommit: "0123456789abcdef",
+		trailerSourceBranch: "main",
+		trailerCIJobURL:     "https://gitlab.example/app/-/jobs/7",
+		trailerVersion:      version.Version,
+	}, trailers)
+}
+
+func TestCommandsDeployCommitIsAuthoredByCurrentUser(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	helperClearCIEnv(t)
+	t.Setenv("CI_COMMIT_SHA", "0123456789abcdef")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user":
+			fmt.Fprint(w, `{"id": 1, "email": "grace@hopper.example", "first_name": "Grace", "last_name": "Hopper"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = u
+	api.MaxAttempts = 1
+	remote, _ := helperEnvironmentRemote(t)
+	c := DeployCmd{Directory: t.TempDir(), GitRemote: remote, Environment: "dev", AppPath: "nodejs", CloneMemoryMB: 256, Message: "Release 1.2"}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	g := &GS{}
+
+	// Invoke
+	err = helperRecordPayload(t, &c, UploadResponse{PayloadID: "two", SHA256: "f00d"}, &logWriters)
+	history, historyErr := g.PayloadHistory(&c, &logWriters)
+
+	// Test
+	assert.NoError(err)
+	assert.NoError(historyErr)
+	if assert.Len(history, 2) {
+		assert.Equal("Grace Hopper", history[0].AuthorName)
+		assert.Equal("grace@hopper.example", history[0].AuthorEmail)
+		assert.Equal("Release 1.2", history[0].Message)
+		assert.Equal("0123456789abcdef", history[0].Trailers[trailerSourceCommit])
+		assert.Equal("f00d", history[0].Trailers[trailerPayloadHash])
+		assert.Equal(version.Version, history[0].Trailers[trailerVersion])
+		assert.Equal("0123456 (main)", historySource(PayloadHistoryEntry{Trailers: map[string]string{trailerSourceCommit: "0123456789abcdef", trailerSourceBranch: "main"}}))
+	}
+}
@@ -0,0 +1,601 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Severity is how serious a validation finding is
+type Severity int
+
+const (
+	// SeverityWarning findings are reported, but don't stop a deploy
+	SeverityWarning Severity = iota
+	// SeverityError findings stop a deploy
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Finding is a problem a Validator found with an app
+type Finding struct {
+	Validator string
+	Severity  Severity
+	Message   string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s", f.Severity, f.Validator, f.Message)
+}
+
+// ValidationContext describes the app being deployed to validators
+type ValidationContext struct {
+	// Dir is the app's directory
+	Dir string
+	// Files are the paths that will be packaged, as returned by BuildFilelist
+	Files []string
+	// PackageJSON is the app's package.json, or nil if it doesn't have one
+	PackageJSON *PackageJSON
+	// SectionConfig is the section.config.json in the environment repository, or nil if it couldn't be read
+	SectionConfig *SectionConfigJSON
+	// ModuleName is the name of the module in the proxychain the app is deployed to
+	ModuleName string
+	// LargeFileSize is the size in bytes above which a file is reported
+	LargeFileSize int64
+}
+
+// Rel returns path relative to the app's directory, with forward slashes
+func (vc *ValidationContext) Rel(path string) string {
+	rel, err := filepath.Rel(vc.Dir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Validator checks an app before it is packaged
+type Validator interface {
+	// Name identifies the validator, so it can be skipped with --skip-validator
+	Name() string
+	Validate(vc *ValidationContext) []Finding
+}
+
+// validatorFunc adapts a function to a Validator
+type validatorFunc struct {
+	name     string
+	validate func(vc *ValidationContext) []Finding
+}
+
+func (v validatorFunc) Name() string { return v.name }
+
+func (v validatorFunc) Validate(vc *ValidationContext) []Finding { return v.validate(vc) }
+
+// Validators are run against an app before it is packaged, in order
+var Validators = []Validator{
+	validatorFunc{"static-site", validateStaticSite},
+	validatorFunc{"node-app", validateNodeApp},
+	validatorFunc{"entry-file", validateEntryFile},
+	validatorFunc{"node-engine", validateNodeEngine},
+	validatorFunc{"native-addons", validateNativeAddons},
+	validatorFunc{"dev-dependencies", validateDevDependencies},
+	validatorFunc{"symlinks", validateSymlinks},
+	validatorFunc{"file-size", validateFileSize},
+}
+
+// ValidatorNames returns the names of all validators
+func ValidatorNames() (names []string) {
+	for _, v := range Validators {
+		names = append(names, v.Name())
+	}
+	return names
+}
+
+// RunValidators runs the named validators against the app, except those named in skip, and returns their findings
+func RunValidators(vc *ValidationContext, run []string, skip []string) (findings []Finding, err error) {
+	skipped := map[string]bool{}
+	for _, s := range skip {
+		found := false
+		for _, v := range Validators {
+			if v.Name() == s {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown validator %q, expected one of: %s", s, strings.Join(ValidatorNames(), ", "))
+		}
+		skipped[s] = true
+	}
+	selected := map[string]bool{}
+	for _, r := range run {
+		selected[r] = true
+	}
+	for _, v := range Validators {
+		if !selected[v.Name()] {
+			continue
+		}
+		if skipped[v.Name()] {
+			log.Debug().Str("Validator", v.Name()).Msg("Skipping validator")
+			continue
+		}
+		findings = append(findings, v.Validate(vc)...)
+	}
+	return findings, nil
+}
+
+// NewValidationContext describes the app in dir, to be packaged from files
+func NewValidationContext(dir string, files []string, moduleName string) *ValidationContext {
+	vc := &ValidationContext{Dir: dir, Files: files, ModuleName: moduleName}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		if p, err := ParsePackageJSON(string(b)); err == nil {
+			vc.PackageJSON = &p
+		}
+	}
+	return vc
+}
+
+// validateStaticSite checks a static site has an index page
+func validateStaticSite(vc *ValidationContext) (findings []Finding) {
+	for _, f := range vc.Files {
+		if vc.Rel(f) == "index.html" {
+			return nil
+		}
+	}
+	return []Finding{{Validator: "static-site", Severity: SeverityError, Message: "index.html is not in the package"}}
+}
+
+// validateNodeApp checks for a start script and installed dependencies
+func validateNodeApp(vc *ValidationContext) (findings []Finding) {
+	for _, err := range IsValidNodeApp(vc.Dir) {
+		findings = append(findings, Finding{Severity: SeverityError, Message: err.Error()})
+	}
+	return withValidator("node-app", findings)
+}
+
+// validateEntryFile checks that the file the start script runs is packaged
+func validateEntryFile(vc *ValidationContext) (findings []Finding) {
+	p := vc.PackageJSON
+	if p == nil {
+		return nil
+	}
+	packaged := map[string]bool{}
+	for _, f := range vc.Files {
+		packaged[vc.Rel(f)] = true
+	}
+	exists := func(entry string) bool {
+		entry = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(entry)), "./")
+		for _, candidate := range []string{entry, entry + ".js", entry + "/index.js"} {
+			if packaged[candidate] {
+				return true
+			}
+		}
+		return false
+	}
+	main := p.Main
+	if main == "" {
+		main = "index.js"
+	}
+
+	script := p.Scripts["start"]
+	if p.Section.StartScript != "" {
+		script = p.Scripts[p.Section.StartScript]
+	}
+	entry, runsNode := startScriptEntry(script)
+	switch {
+	case runsNode && (entry == "" || entry == "."):
+		if !exists(main) {
+			findings = append(findings, Finding{Severity: SeverityError, Message: fmt.Sprintf("the start script runs %s, which is not in the package", main)})
+		}
+	case runsNode:
+		if !exists(entry) {
+			findings = append(findings, Finding{Severity: SeverityError, Message: fmt.Sprintf("the start script runs %s, which is not in the package", entry)})
+		}
+	case p.Main != "" && !exists(p.Main):
+		findings = append(findings, Finding{Severity: SeverityWarning, Message: fmt.Sprintf("package.json main file %s is not in the package", p.Main)})
+	}
+	return withValidator("entry-file", findings)
+}
+
+// startScriptEntry returns the file run by a start script like "node server.js", and
+// whether the script runs node at all.
+func startScriptEntry(script string) (entry string, runsNode bool) {
+	fields := strings.Fields(script)
+	for i, f := range fields {
+		if f != "node" && f != "nodemon" {
+			continue
+		}
+		for _, arg := range fields[i+1:] {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			if arg == "&&" || arg == ";" || arg == "|" {
+				break
+			}
+			return arg, true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// validateNodeEngine checks the node version required in package.json can be met by the module's image
+func validateNodeEngine(vc *ValidationContext) (findings []Finding) {
+	if vc.PackageJSON == nil {
+		return nil
+	}
+	required := strings.TrimSpace(vc.PackageJSON.Engines["node"])
+	if required == "" {
+		return nil
+	}
+	if vc.SectionConfig == nil {
+		log.Warn().Str("Validator", "node-engine").Msg("Skipping the check, as the environment's section.config.json couldn't be read")
+		return nil
+	}
+	image := ""
+	for _, m := range vc.SectionConfig.Proxychain {
+		if m.Name == vc.ModuleName {
+			image = m.Image
+		}
+	}
+	v, parts, ok := imageNodeVersion(image)
+	if !ok {
+		log.Debug().Str("Image", image).Msg("Unable to tell the node version of the module's image")
+		return nil
+	}
+	r, ok := parseVersionRange(required)
+	if !ok {
+		return []Finding{{Validator: "node-engine", Severity: SeverityWarning, Message: fmt.Sprintf("unable to understand the node engine %q in package.json", required)}}
+	}
+	if !r.allows(v, parts) {
+		findings = append(findings, Finding{Severity: SeverityError, Message: fmt.Sprintf("package.json requires node %s, but the %s module runs %s", required, vc.ModuleName, image)})
+	}
+	return withValidator("node-engine", findings)
+}
+
+// nativeAddonPlatforms maps the magic numbers of executable formats to the platforms using them
+var nativeAddonPlatforms = []struct {
+	magic    []byte
+	platform string
+}{
+	{[]byte{0x7f, 'E', 'L', 'F'}, "linux"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "darwin"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "darwin"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "darwin"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "darwin"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "darwin"},
+	{[]byte{'M', 'Z'}, "windows"},
+}
+
+// validateNativeAddons checks that compiled .node addons were built for Linux, which is what Section runs
+func validateNativeAddons(vc *ValidationContext) (findings []Finding) {
+	for _, f := range vc.Files {
+		if filepath.Ext(f) != ".node" {
+			continue
+		}
+		platform := nativeAddonPlatform(f)
+		if platform == "" || platform == "linux" {
+			continue
+		}
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("%s is built for %s, not linux. Reinstall your dependencies on Linux, or in a Linux container", vc.Rel(f), platform),
+		})
+	}
+	return withValidator("native-addons", findings)
+}
+
+// nativeAddonPlatform returns the platform a compiled addon was built for, or "" if it can't be told
+func nativeAddonPlatform(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	header := make([]byte, 4)
+	n, _ := f.Read(header)
+	for _, p := range nativeAddonPlatforms {
+		if n >= len(p.magic) && bytes.Equal(header[:len(p.magic)], p.magic) {
+			return p.platform
+		}
+	}
+	return ""
+}
+
+// validateDevDependencies reports devDependencies installed in node_modules, which make the package bigger for no benefit
+func validateDevDependencies(vc *ValidationContext) (findings []Finding) {
+	if vc.PackageJSON == nil || len(vc.PackageJSON.DevDependencies) == 0 {
+		return nil
+	}
+	sizes := map[string]int64{}
+	for _, f := range vc.Files {
+		parts := strings.Split(vc.Rel(f), "/")
+		if len(parts) < 2 || parts[0] != "node_modules" {
+			continue
+		}
+		name := parts[1]
+		if strings.HasPrefix(name, "@") && len(parts) > 2 {
+			name += "/" + parts[2]
+		}
+		if _, ok := vc.PackageJSON.DevDependencies[name]; !ok {
+			continue
+		}
+		if _, ok := vc.PackageJSON.Dependencies[name]; ok {
+			continue
+		}
+		fi, err := os.Lstat(f)
+		if err != nil {
+			continue
+		}
+		size := sizes[name]
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		sizes[name] = size
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	var names []string
+	var total int64
+	for name, size := range sizes {
+		names = append(names, name)
+		total += size
+	}
+	sort.Strings(names)
+	return []Finding{{
+		Validator: "dev-dependencies",
+		Severity:  SeverityWarning,
+		Message:   fmt.Sprintf("%d devDependencies add %s to the package: %s. Run npm prune --production before deploying", len(names), formatBytes(total), strings.Join(names, ", ")),
+	}}
+}
+
+// validateSymlinks checks symlinks point inside the app, as anything outside it isn't packaged
+func validateSymlinks(vc *ValidationContext) (findings []Finding) {
+	root, err := filepath.Abs(vc.Dir)
+	if err != nil {
+		return nil
+	}
+	for _, f := range vc.Files {
+		fi, err := os.Lstat(f)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := os.Readlink(f)
+		if err != nil {
+			continue
+		}
+		resolved := target
+		if !filepath.IsAbs(target) {
+			abs, err := filepath.Abs(f)
+			if err != nil {
+				continue
+			}
+			resolved = filepath.Join(filepath.Dir(abs), target)
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("%s links to %s, which is outside the app and won't be deployed", vc.Rel(f), target),
+			})
+		}
+	}
+	return withValidator("symlinks", findings)
+}
+
+// validateFileSize reports files bigger than the large file size
+func validateFileSize(vc *ValidationContext) (findings []Finding) {
+	if vc.LargeFileSize <= 0 {
+		return nil
+	}
+	for _, f := range vc.Files {
+		fi, err := os.Lstat(f)
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() <= vc.LargeFileSize {
+			continue
+		}
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s is %s. Exclude it in %s if it isn't needed to run the app", vc.Rel(f), formatBytes(fi.Size()), IgnoreFile),
+		})
+	}
+	return withValidator("file-size", findings)
+}
+
+func withValidator(name string, findings []Finding) []Finding {
+	for i := range findings {
+		findings[i].Validator = name
+	}
+	return findings
+}
+
+// semver is a version's major, minor and patch numbers
+type semver [3]int
+
+// maxSemver is greater than any real version
+var maxSemver = semver{1 << 30}
+
+func (v semver) less(o semver) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+// bump returns the smallest version greater than every version matching the first parts of v,
+// so bump(14.2, 1) is 15.0.0
+func (v semver) bump(parts int) semver {
+	if parts == 0 {
+		return maxSemver
+	}
+	var b semver
+	copy(b[:], v[:parts])
+	b[parts-1]++
+	return b
+}
+
+// parseVersion parses a possibly partial version like 14, 14.17 or 14.x, returning how many parts were given
+func parseVersion(s string) (v semver, parts int, ok bool) {
+	s = strings.TrimLeft(strings.TrimSpace(s), "v=")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" || s == "*" || s == "x" || s == "X" {
+		return v, 0, true
+	}
+	for i, p := range strings.Split(s, ".") {
+		if i >= len(v) {
+			return v, 0, false
+		}
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, 0, false
+		}
+		v[i] = n
+		parts = i + 1
+	}
+	return v, parts, true
+}
+
+// versionInterval is the versions from lo up to, but not including, hi
+type versionInterval struct {
+	lo, hi semver
+}
+
+// versionRange is a set of version intervals, any of which is allowed
+type versionRange []versionInterval
+
+// allows reports whether any version matching the first parts of v is in the range
+func (r versionRange) allows(v semver, parts int) bool {
+	vhi := v.bump(parts)
+	for _, i := range r {
+		lo, hi := i.lo, i.hi
+		if lo.less(v) {
+			lo = v
+		}
+		if vhi.less(hi) {
+			hi = vhi
+		}
+		if lo.less(hi) {
+			return true
+		}
+	}
+	return false
+}
+
+var rangeOperatorSpace = regexp.MustCompile(`(>=|<=|>|<|=|\^|~)\s+`)
+
+// parseVersionRange parses a version range as used in package.json engines, like ">=14",
+// "^12.20 || >=14.13" or "14.x"
+func parseVersionRange(s string) (r versionRange, ok bool) {
+	for _, set := range strings.Split(s, "||") {
+		set = rangeOperatorSpace.ReplaceAllString(strings.TrimSpace(set), "$1")
+		interval := versionInterval{hi: maxSemver}
+		if bounds := strings.SplitN(set, " - ", 2); len(bounds) == 2 {
+			lo, _, ok1 := parseVersion(bounds[0])
+			hi, parts, ok2 := parseVersion(bounds[1])
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			r = append(r, versionInterval{lo: lo, hi: hi.bump(parts)})
+			continue
+		}
+		for _, comparator := range strings.Fields(set) {
+			c, ok := comparatorInterval(comparator)
+			if !ok {
+				return nil, false
+			}
+			if interval.lo.less(c.lo) {
+				interval.lo = c.lo
+			}
+			if c.hi.less(interval.hi) {
+				interval.hi = c.hi
+			}
+		}
+		r = append(r, interval)
+	}
+	return r, true
+}
+
+// comparatorInterval returns the versions allowed by a single comparator like >=14.1 or ^12
+func comparatorInterval(c string) (i versionInterval, ok bool) {
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<", "^", "~", "="} {
+		if strings.HasPrefix(c, o) {
+			op, c = o, c[len(o):]
+			break
+		}
+	}
+	v, parts, ok := parseVersion(c)
+	if !ok {
+		return i, false
+	}
+	i.hi = maxSemver
+	switch op {
+	case ">=":
+		i.lo = v
+	case ">":
+		i.lo = v.bump(parts)
+	case "<":
+		i.hi = v
+	case "<=":
+		i.hi = v.bump(parts)
+	case "^":
+		i.lo = v
+		i.hi = v.bump(parts)
+		for n := 0; n < parts; n++ {
+			if v[n] != 0 {
+				i.hi = v.bump(n + 1)
+				break
+			}
+		}
+	case "~":
+		i.lo = v
+		if parts > 2 {
+			i.hi = v.bump(2)
+		} else {
+			i.hi = v.bump(parts)
+		}
+	default:
+		i.lo = v
+		i.hi = v.bump(parts)
+	}
+	return i, true
+}
+
+// imageTagVersion matches the version at the start of an image tag, like 14.17.0 or 14-alpine
+var imageTagVersion = regexp.MustCompile(`^v?(\d+(?:\.\d+){0,2})`)
+
+// imageNodeVersion returns the node version of a node.js module image, like nodejs:14.17,
+// from its tag. It returns false for other images, or tags that aren't versions.
+func imageNodeVersion(image string) (v semver, parts int, ok bool) {
+	name, tag := image, ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+	if !strings.Contains(filepath.Base(name), "node") {
+		return v, 0, false
+	}
+	m := imageTagVersion.FindStringSubmatch(tag)
+	if m == nil {
+		return v, 0, false
+	}
+	return parseVersion(m[1])
+}
@@ -0,0 +1,271 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helperValidationContext writes files into a new app directory and describes it for validators
+func helperValidationContext(t *testing.T, files map[string]string) *ValidationContext {
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := BuildFilelist(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewValidationContext(dir, paths, "nodejs")
+}
+
+func TestCommandsDeployValidatorsParseVersionRange(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		r       string
+		version string
+		allowed bool
+	}{
+		{">=14", "14", true},
+		{">=14", "12", false},
+		{">= 14.17.0", "14", true},
+		{">=14.17.0", "14.16.1", false},
+		{"^12.20 || >=14.13", "12", true},
+		{"^12.20 || >=14.13", "13", false},
+		{"^12.20 || >=14.13", "16.3.0", true},
+		{"14.x", "14.17.0", true},
+		{"14.x", "15", false},
+		{"~14.17.0", "14.18", false},
+		{">12 <15", "14", true},
+		{">12 <15", "15.0.0", false},
+		{"12 - 14", "14.17.0", true},
+		{"12 - 14", "16", false},
+		{"*", "10", true},
+		{"^0.10", "0.10.48", true},
+		{"<=14.2", "14.2.9", true},
+		{"<=14.2", "14.3", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.r+" "+tc.version, func(t *testing.T) {
+			// Invoke
+			r, ok := parseVersionRange(tc.r)
+			v, parts, vok := parseVersion(tc.version)
+
+			// Test
+			assert.True(ok)
+			assert.True(vok)
+			assert.Equal(tc.allowed, r.allows(v, parts))
+		})
+	}
+}
+
+func TestCommandsDeployValidatorsChecksNodeEngineAgainstImage(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		engine string
+		image  string
+		errors int
+	}{
+		{">=14", "gcr.io/section-io/nodejs:14.17.0", 0},
+		{">=16", "gcr.io/section-io/nodejs:14.17.0", 1},
+		{">=16", "node:14-alpine", 1},
+		{">=16", "varnish:6.0", 0},
+		{"", "nodejs:12", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.engine+" "+tc.image, func(t *testing.T) {
+			// Setup
+			vc := helperValidationContext(t, map[string]string{
+				"package.json": `{"engines": {"node": "` + tc.engine + `"}}`,
+			})
+			vc.SectionConfig = &SectionConfigJSON{Proxychain: []ProxychainModule{{Name: "nodejs", Image: tc.image}}}
+
+			// Invoke
+			findings := validateNodeEngine(vc)
+
+			// Test
+			assert.Len(findings, tc.errors)
+		})
+	}
+}
+
+func TestCommandsDeployPackageChecksNodeEngineAgainstEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"engines": {"node": ">=16"}}`), 0644))
+	globalGitService = &MockGitService{Config: &SectionConfigJSON{Proxychain: []ProxychainModule{{Name: "nodejs", Image: "nodejs:14"}}}}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	c := DeployCmd{Directory: dir, AccountID: 1, AppID: 2, Environment: "dev", SkipValidator: []string{"node-app", "entry-file"}}
+
+	// Invoke
+	err := (&DeployPackageCmd{Out: filepath.Join(t.TempDir(), "app.tar.gz")}).Run(&logWriters, &c)
+
+	// Test
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "requires node >=16, but the nodejs module runs nodejs:14")
+	}
+}
+
+func TestCommandsDeployValidatorsDetectsNativeAddonPlatform(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	vc := helperValidationContext(t, map[string]string{
+		"node_modules/linux/build/Release/addon.node":   "\x7fELF\x02\x01",
+		"node_modules/darwin/build/Release/addon.node":  "\xcf\xfa\xed\xfe\x07",
+		"node_modules/windows/build/Release/addon.node": "MZ\x90\x00",
+	})
+
+	// Invoke
+	findings := validateNativeAddons(vc)
+
+	// Test
+	assert.Len(findings, 2)
+	for _, f := range findings {
+		assert.Equal(SeverityError, f.Severity)
+		assert.Equal("native-addons", f.Validator)
+		assert.NotContains(f.Message, "node_modules/linux/")
+	}
+}
+
+func TestCommandsDeployValidatorsReportsDevDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	vc := helperValidationContext(t, map[string]string{
+		"package.json":                        `{"dependencies": {"express": "^4", "typescript": "^4"}, "devDependencies": {"jest": "^27", "@types/node": "^16", "typescript": "^4"}}`,
+		"node_modules/express/index.js":       "module.exports = {}",
+		"node_modules/jest/index.js":          "module.exports = {}",
+		"node_modules/@types/node/index.d.ts": "",
+		"node_modules/typescript/index.js":    "module.exports = {}",
+	})
+
+	// Invoke
+	findings := validateDevDependencies(vc)
+
+	// Test
+	if assert.Len(findings, 1) {
+		assert.Equal(SeverityWarning, findings[0].Severity)
+		assert.Contains(findings[0].Message, "@types/node, jest")
+		assert.NotContains(findings[0].Message, "typescript")
+	}
+}
+
+func TestCommandsDeployValidatorsChecksEntryFile(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		name     string
+		files    map[string]string
+		severity []Severity
+	}{
+		{"start script file present", map[string]string{"package.json": `{"scripts": {"start": "node --max-old-space-size=512 server.js"}}`, "server.js": ""}, nil},
+		{"start script file missing", map[string]string{"package.json": `{"scripts": {"start": "node server.js"}}`}, []Severity{SeverityError}},
+		{"start script runs main", map[string]string{"package.json": `{"main": "dist/app.js", "scripts": {"start": "node ."}}`, "dist/app.js": ""}, nil},
+		{"start script runs missing main", map[string]string{"package.json": `{"main": "dist/app.js", "scripts": {"start": "node ."}}`}, []Severity{SeverityError}},
+		{"main missing", map[string]string{"package.json": `{"main": "index.js", "scripts": {"start": "npx serve"}}`}, []Severity{SeverityWarning}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Setup
+			vc := helperValidationContext(t, tc.files)
+
+			// Invoke
+			findings := validateEntryFile(vc)
+
+			// Test
+			var severity []Severity
+			for _, f := range findings {
+				severity = append(severity, f.Severity)
+			}
+			assert.Equal(tc.severity, severity)
+		})
+	}
+}
+
+func TestCommandsDeployValidatorsReportsSymlinksOutsideApp(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	vc := helperValidationContext(t, map[string]string{
+		"node_modules/pkg/cli.js": "",
+	})
+	assert.NoError(os.MkdirAll(filepath.Join(vc.Dir, "node_modules", ".bin"), 0755))
+	assert.NoError(os.Symlink("../pkg/cli.js", filepath.Join(vc.Dir, "node_modules", ".bin", "pkg")))
+	assert.NoError(os.Symlink("../../shared", filepath.Join(vc.Dir, "node_modules", "shared")))
+	assert.NoError(os.Symlink("/etc/hosts", filepath.Join(vc.Dir, "hosts")))
+	files, err := BuildFilelist(vc.Dir, nil)
+	assert.NoError(err)
+	vc.Files = files
+
+	// Invoke
+	findings := validateSymlinks(vc)
+
+	// Test
+	assert.Len(findings, 2)
+	for _, f := range findings {
+		assert.NotContains(f.Message, ".bin")
+	}
+}
+
+func TestCommandsDeployValidatorsReportsLargeFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	vc := helperValidationContext(t, map[string]string{
+		"small.txt": "hello",
+		"large.bin": string(make([]byte, 2048)),
+	})
+	vc.LargeFileSize = 1024
+
+	// Invoke
+	findings := validateFileSize(vc)
+
+	// Test
+	if assert.Len(findings, 1) {
+		assert.Contains(findings[0].Message, "large.bin")
+	}
+}
+
+func TestCommandsDeployValidatorsCanBeSkipped(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	vc := helperValidationContext(t, map[string]string{
+		"package.json": `{"scripts": {"start": "node server.js"}}`,
+	})
+
+	// Invoke
+	run := []string{"node-app", "entry-file"}
+	all, err := RunValidators(vc, run, nil)
+	assert.NoError(err)
+	skipped, err := RunValidators(vc, run, []string{"node-app", "entry-file"})
+	assert.NoError(err)
+	_, unknownErr := RunValidators(vc, run, []string{"no-such-check"})
+
+	// Test
+	var validators []string
+	for _, f := range all {
+		validators = append(validators, f.Validator)
+	}
+	assert.Contains(validators, "node-app")
+	assert.Contains(validators, "entry-file")
+	assert.Empty(skipped)
+	assert.Error(unknownErr)
+}
@@ -2,7 +2,9 @@ package commands
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,23 +14,59 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/section/sectionctl/api"
 	"github.com/stretchr/testify/assert"
 )
 
 
 type MockGitService struct {
-	Called bool
+	Called     bool
+	Current    PayloadValue
+	CurrentErr error
+	Config     *SectionConfigJSON
 }
 
-func (g *MockGitService) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd,response UploadResponse,logWriters *LogWriters) error {
+func (g *MockGitService) PayloadHistory(c *DeployCmd, logWriters *LogWriters) ([]PayloadHistoryEntry, error) {
 	g.Called = true
+	return nil, nil
+}
+
+func (g *MockGitService) OpenDeploy(c *DeployCmd, logWriters *LogWriters) (DeployTarget, error) {
+	return &mockDeployTarget{g: g}, nil
+}
+
+type mockDeployTarget struct {
+	g *MockGitService
+}
+
+func (t *mockDeployTarget) Current() (PayloadValue, error) {
+	return t.g.Current, t.g.CurrentErr
+}
+
+func (t *mockDeployTarget) SectionConfig() (*SectionConfigJSON, error) {
+	return t.g.Config, nil
+}
+
+func (t *mockDeployTarget) Record(response UploadResponse) error {
+	t.g.Called = true
 	return nil
 }
 
+func (t *mockDeployTarget) Close() error {
+	return nil
+}
+
+func (g *MockGitService) Rollback(c *DeployCmd, payloadID string, logWriters *LogWriters) (PayloadHistoryEntry, error) {
+	g.Called = true
+	return PayloadHistoryEntry{PayloadID: payloadID}, nil
+}
+
 func helperLoadBytes(t *testing.T, name string) []byte {
 	path := filepath.Join("testdata", name) // relative path
 	bytes, err := ioutil.ReadFile(path)
@@ -110,7 +148,7 @@ func TestCommandsDeployCreateTarballAlwaysPutsAppAtRoot(t *testing.T) {
 			assert.NoError(err)
 
 			// Create the tarball
-			err = CreateTarball(tempFile, paths)
+			_, err = CreateTarball(tempFile, paths)
 			assert.NoError(err)
 
 			_, err = tempFile.Seek(0, 0)
@@ -218,6 +256,7 @@ func TestCommandsDeployUploadsTarball(t *testing.T) {
 		called    bool
 		token     string
 		accountID int
+		sha256    string
 		file      []byte
 	}
 	var uploadReq req
@@ -241,6 +280,7 @@ func TestCommandsDeployUploadsTarball(t *testing.T) {
 			aid, err := strconv.Atoi(r.FormValue("account_id"))
 			assert.NoError(err)
 			uploadReq.accountID = aid
+			uploadReq.sha256 = r.FormValue("sha256")
 
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, string(helperLoadBytes(t, "deploy/upload.response.with_success.json")))
@@ -270,7 +310,7 @@ func TestCommandsDeployUploadsTarball(t *testing.T) {
 	}
 	kongContext := kong.Context{}
 	logWriters := LogWriters{ConsoleWriter: io.Discard,FileWriter: io.Discard,ConsoleOnly: io.Discard,CarriageReturnWriter: io.Discard}
-	err = c.Run(&kongContext, &logWriters)
+	err = c.Deploy(&CLI{}, &kongContext, &logWriters)
 
 	// Test
 	assert.NoError(err)
@@ -281,6 +321,319 @@ func TestCommandsDeployUploadsTarball(t *testing.T) {
 	assert.NotZero(len(uploadReq.file))
 	assert.Equal([]byte{0x1f, 0x8b}, uploadReq.file[0:2]) // gzip header
 	assert.Equal(c.AccountID, uploadReq.accountID)
+	assert.Len(uploadReq.sha256, 64)
 
 	assert.True(mockGit.Called)
 }
+
+func TestCommandsDeployFileUploadRequestStreamsBodyWithProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	f, err := ioutil.TempFile("", "sectionctl-deploy")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	contents := make([]byte, 256*1024)
+	_, err = f.Write(contents)
+	assert.NoError(err)
+	_, err = f.Seek(0, 0)
+	assert.NoError(err)
+
+	u, err := url.Parse("http://127.0.0.1/")
+	assert.NoError(err)
+	c := DeployCmd{ServerURL: u, AccountID: 100, AppID: 200}
+
+	var out bytes.Buffer
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: &out, CarriageReturnWriter: io.Discard}
+	progress := NewProgressBar("Uploading app", int64(len(contents)), &CLI{Quiet: true}, &logWriters)
+
+	// Invoke
+	req, err := newFileUploadRequest(&c, f, int64(len(contents)), "", progress)
+	assert.NoError(err)
+	body, err := ioutil.ReadAll(req.Body)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(req.ContentLength, int64(len(body)))
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	assert.NoError(req.ParseMultipartForm(MaxFileSize))
+	assert.Equal("100", req.FormValue("account_id"))
+	assert.Equal("200", req.FormValue("app_id"))
+	file, _, err := req.FormFile("file")
+	assert.NoError(err)
+	uploaded, err := ioutil.ReadAll(file)
+	assert.NoError(err)
+	assert.Equal(contents, uploaded)
+
+	assert.Contains(out.String(), "Uploading app: 50%")
+	assert.Contains(out.String(), "Uploading app: 100%")
+}
+
+func TestCommandsDeployBuildFilelistUsesGitignoreSemantics(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir, err := ioutil.TempDir("", "sectionctl-deploy")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	for _, f := range []string{
+		".git/config",
+		".gitkeep-stuff/a",
+		"my.github-thing",
+		"test/a.test.js",
+		"src/test/fixture.js",
+		"app.js",
+		"app.js.map",
+		"keep.map",
+		".env",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(ioutil.WriteFile(path, []byte(f), 0644))
+	}
+	ignoreFile := "# build artifacts\n/test/\n*.map\n!keep.map\n\n.env\n"
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, IgnoreFile), []byte(ignoreFile), 0644))
+
+	fileIgnores, err := ReadIgnoreFile(dir)
+	assert.NoError(err)
+	assert.Equal([]string{"/test/", "*.map", "!keep.map", ".env"}, fileIgnores)
+	ignores := append(append([]string{}, DefaultIgnores...), fileIgnores...)
+
+	// Invoke
+	paths, err := BuildFilelist(dir, ignores)
+	assert.NoError(err)
+
+	// Test
+	var out bytes.Buffer
+	assert.NoError(printFilelist(&out, paths))
+	listed := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.ElementsMatch([]string{
+		".gitkeep-stuff/",
+		".gitkeep-stuff/a",
+		".sectionignore",
+		"my.github-thing",
+		"src/",
+		"src/test/",
+		"src/test/fixture.js",
+		"app.js",
+		"keep.map",
+	}, listed)
+}
+
+func TestCommandsDeployDryRunDoesNotUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.FailNowf("unexpected request", "URL: %s", r.URL.Path)
+	}))
+	defer ts.Close()
+	url, err := url.Parse(ts.URL)
+	assert.NoError(err)
+
+	mockGit := MockGitService{}
+	globalGitService = &mockGit
+	c := DeployCmd{
+		Directory: filepath.Join("testdata", "deploy", "valid-nodejs-app"),
+		ServerURL: url,
+		AppPath:   "nodejs",
+		DryRun:    true,
+	}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	err = c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	assert.NoError(err)
+	assert.False(mockGit.Called)
+}
+
+func TestCommandsDeployDefaultsToPush(t *testing.T) {
+	assert := assert.New(t)
+
+	var testCases = []struct {
+		args    []string
+		command string
+	}{
+		{[]string{"deploy", "-a", "1", "-i", "2"}, "deploy push"},
+		{[]string{"deploy", "history", "-a", "1", "-i", "2"}, "deploy history"},
+		{[]string{"deploy", "-a", "1", "-i", "2", "rollback", "--payload-id", "abc"}, "deploy rollback"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			// Setup
+			var cli CLI
+			parser, err := kong.New(&cli, kong.Exit(func(int) { t.Fatal("exited") }))
+			assert.NoError(err)
+
+			// Invoke
+			ctx, err := parser.Parse(tc.args)
+
+			// Test
+			assert.NoError(err)
+			assert.Equal(tc.command, ctx.Command())
+			assert.Equal(1, cli.Deploy.AccountID)
+			assert.Equal(2, cli.Deploy.AppID)
+			assert.Equal(uploadModeSingle, cli.Deploy.UploadMode)
+		})
+	}
+}
+
+func TestCommandsDeployCreateTarballIsReproducible(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	for _, name := range []string{"b.js", "a-c.js", "a/z.js", "a/b.js", "bin/run"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(ioutil.WriteFile(path, []byte(name), 0644))
+	}
+	assert.NoError(os.Chmod(filepath.Join(dir, "bin", "run"), 0700))
+	pack := func() ([]byte, string) {
+		paths, err := BuildFilelist(dir, nil)
+		assert.NoError(err)
+		var buf bytes.Buffer
+		digest, err := CreateTarball(&buf, paths)
+		assert.NoError(err)
+		return buf.Bytes(), digest
+	}
+
+	// Invoke
+	first, firstDigest := pack()
+	later := time.Now().Add(48 * time.Hour)
+	assert.NoError(os.Chtimes(filepath.Join(dir, "b.js"), later, later))
+	assert.NoError(os.Chmod(filepath.Join(dir, "a", "b.js"), 0600))
+	second, secondDigest := pack()
+
+	// Test
+	assert.Equal(first, second)
+	assert.Equal(firstDigest, secondDigest)
+	assert.Len(firstDigest, 64)
+
+	zr, err := gzip.NewReader(bytes.NewReader(first))
+	assert.NoError(err)
+	tr := tar.NewReader(zr)
+	var names []string
+	modes := map[string]int64{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(err)
+		names = append(names, h.Name)
+		modes[h.Name] = h.Mode
+		assert.True(h.ModTime.Equal(tarballModTime))
+		assert.Equal(0, h.Uid)
+		assert.Equal(0, h.Gid)
+		assert.Empty(h.Uname)
+	}
+	assert.Equal([]string{"", "/a", "/a-c.js", "/a/b.js", "/a/z.js", "/b.js", "/bin", "/bin/run"}, names)
+	assert.Equal(int64(0o755), modes["/a"])
+	assert.Equal(int64(0o644), modes["/a/b.js"])
+	assert.Equal(int64(0o755), modes["/bin/run"])
+}
+
+func TestCommandsDeploySkipsPackageAlreadyDeployed(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	uploads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			uploads++
+			fmt.Fprint(w, string(helperLoadBytes(t, "deploy/upload.response.with_success.json")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	url, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = url
+	api.MaxAttempts = 1
+
+	dir := filepath.Join("testdata", "deploy", "valid-nodejs-app")
+	paths, err := BuildFilelist(dir, DefaultIgnores)
+	assert.NoError(err)
+	digest, err := CreateTarball(io.Discard, paths)
+	assert.NoError(err)
+
+	mockGit := MockGitService{Current: PayloadValue{ID: "current", SHA256: digest}}
+	globalGitService = &mockGit
+	c := DeployCmd{Directory: dir, ServerURL: url, AccountID: 100, AppID: 200, Environment: "dev", Kind: "nodejs"}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	unchangedErr := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+	unchangedUploads, unchangedCalled := uploads, mockGit.Called
+	c.Force = true
+	forcedErr := c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	assert.NoError(unchangedErr)
+	assert.Equal(0, unchangedUploads)
+	assert.False(unchangedCalled)
+	assert.NoError(forcedErr)
+	assert.Equal(1, uploads)
+	assert.True(mockGit.Called)
+}
+
+func TestCommandsDeployChecksModuleBeforeUploading(t *testing.T) {
+	var testCases = []struct {
+		name    string
+		err     error
+		uploads int
+		fails   bool
+	}{
+		{"module not configured", object.ErrFileNotFound, 0, true},
+		{"lookup fails", errors.New("corrupt"), 1, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			uploads := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/":
+					uploads++
+					fmt.Fprint(w, string(helperLoadBytes(t, "deploy/upload.response.with_success.json")))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer ts.Close()
+			url, err := url.Parse(ts.URL)
+			assert.NoError(err)
+			api.PrefixURI = url
+			api.MaxAttempts = 1
+
+			mockGit := MockGitService{CurrentErr: tc.err}
+			globalGitService = &mockGit
+			dir := filepath.Join("testdata", "deploy", "valid-nodejs-app")
+			c := DeployCmd{Directory: dir, ServerURL: url, AccountID: 100, AppID: 200, Environment: "dev", Kind: "nodejs", AppPath: "nodejs"}
+			logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+			// Invoke
+			err = c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+			// Test
+			assert.Equal(tc.uploads, uploads)
+			assert.Equal(!tc.fails, mockGit.Called)
+			if tc.fails {
+				assert.Error(err)
+				assert.Contains(err.Error(), "not configured to host")
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
@@ -19,6 +19,12 @@ type DomainsListCmd struct {
 	AccountID int `short:"a" help:"ID of account to list domains under"`
 }
 
+// AccountDomains represents the domains under a single account
+type AccountDomains struct {
+	AccountID int                   `json:"account_id"`
+	Domains   []api.DomainsResponse `json:"domains"`
+}
+
 // Run executes the command
 func (c *DomainsListCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 	var aids []int
@@ -41,23 +47,27 @@ func (c *DomainsListCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 
 	s := NewSpinner("Looking up domains",logWriters)
 	s.Start()
-	domains := make(map[int][]api.DomainsResponse)
+	var domains []AccountDomains
 	for _, id := range aids {
 		ds, err := api.Domains(id)
 		if err != nil {
 			return fmt.Errorf("unable to look up domains: %w", err)
 		}
-		domains[id] = ds
+		domains = append(domains, AccountDomains{AccountID: id, Domains: ds})
 	}
 	s.Stop()
 
+	if ok, err := WriteStructured(cli, os.Stdout, domains); ok {
+		return err
+	}
+
 	table := NewTable(cli, os.Stdout)
 	table.SetHeader([]string{"Account ID", "Domain", "Engaged"})
 	table.SetHeaderColor(tablewriter.Colors{tablewriter.Normal,tablewriter.FgWhiteColor},tablewriter.Colors{tablewriter.Normal, tablewriter.FgWhiteColor},tablewriter.Colors{tablewriter.Normal, tablewriter.FgWhiteColor})
 	table.SetColumnColor(tablewriter.Colors{tablewriter.Normal,tablewriter.FgWhiteColor},tablewriter.Colors{tablewriter.Bold, tablewriter.FgHiCyanColor},tablewriter.Colors{tablewriter.Normal,tablewriter.FgWhiteColor})
-	for id, ds := range domains {
-		for _, d := range ds {
-			r := []string{strconv.Itoa(id), d.DomainName, fmt.Sprintf("%t", d.Engaged)}
+	for _, ad := range domains {
+		for _, d := range ad.Domains {
+			r := []string{strconv.Itoa(ad.AccountID), d.DomainName, fmt.Sprintf("%t", d.Engaged)}
 			table.Append(r)
 		}
 	}
@@ -2,24 +2,48 @@ package commands
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"path/filepath"
+	"os"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/alecthomas/kong"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
 	gitHTTP "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/rs/zerolog/log"
 	"github.com/section/sectionctl/api"
+	"github.com/section/sectionctl/version"
 )
 
 // GitService interface provides a way to interact with Git
 type GitService interface {
-	UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadResponse, logWriters *LogWriters) error
+	PayloadHistory(c *DeployCmd, logWriters *LogWriters) ([]PayloadHistoryEntry, error)
+	Rollback(c *DeployCmd, payloadID string, logWriters *LogWriters) (PayloadHistoryEntry, error)
+	OpenDeploy(c *DeployCmd, logWriters *LogWriters) (DeployTarget, error)
+}
+
+// DeployTarget is the environment repository a deploy is recorded in, cloned once for the whole deploy
+type DeployTarget interface {
+	// Current returns the payload currently recorded for the module
+	Current() (PayloadValue, error)
+	// SectionConfig returns the environment's section.config.json, or nil if it has none
+	SectionConfig() (*SectionConfigJSON, error)
+	// Record commits and pushes the uploaded payload
+	Record(response UploadResponse) error
+	// Close cleans up after the clone
+	Close() error
 }
 
 // GS ...
@@ -28,41 +52,497 @@ type GS struct{}
 // This is far less then ideal, however Kong does not seem to provide a way to inject dependencies into its commands so we must use this for testing
 var globalGitService GitService = &GS{}
 
-// UpdateGitViaGit clones the application repository to a temporary directory then updates it with the latest payload id and pushes a new commit
-func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadResponse,logWriters *LogWriters) error {
+// PayloadHistoryEntry represents a deploy recorded in the environment repository
+type PayloadHistoryEntry struct {
+	Commit      string    `json:"commit"`
+	When        time.Time `json:"when"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	Message     string    `json:"message"`
+	// Trailers trace the deploy back to its source, see deployTrailers
+	Trailers  map[string]string `json:"trailers,omitempty"`
+	PayloadID string            `json:"payload_id"`
+	SHA256    string            `json:"sha256,omitempty"`
+}
+
+// environmentRepo is a local clone of an app's environment repository
+type environmentRepo struct {
+	// dir is the clone's temporary directory, or empty if it's in memory
+	dir   string
+	url   string
+	auth  transport.AuthMethod
+	repo  *git.Repository
+	depth int
+}
+
+// fileProtocol installs the in-process file:// transport the first time it's needed
+var fileProtocol sync.Once
+
+// installFileProtocol serves file:// remotes in-process, so a local bare repository can stand in
+// for the environment repository without git being installed. go-git's transports are global, so
+// this is only done once a file:// remote is used.
+func installFileProtocol() {
+	fileProtocol.Do(func() {
+		client.InstallProtocol("file", server.DefaultServer)
+	})
+}
+
+// externalSourcePath returns the path of the file recording the deployed payload in the environment repository
+func externalSourcePath(c *DeployCmd) string {
+	return c.AppPath + "/.section-external-source.json"
+}
+
+// environmentRepoURL returns the URL of the app's environment repository, which is --git-remote
+// if set, or else is served from the root of the Section API.
+func environmentRepoURL(c *DeployCmd) (string, error) {
+	if c.GitRemote != "" {
+		return c.GitRemote, nil
+	}
 	app, err := api.Application(c.AccountID, c.AppID)
 	if err != nil {
-		return err
+		return "", err
 	}
 	appName := strings.ReplaceAll(app.ApplicationName, "/", "")
-	cloneDir := fmt.Sprintf("https://aperture.section.io/account/%d/application/%d/%s.git", c.AccountID, c.AppID, appName)
-	log.Debug().Msg(fmt.Sprintf(" Begin updating hash in .section-external-source.json:\n\tsection-configmap-tars/%v/%s.tar.gz\n",c.AccountID,response.PayloadID))
-	tempDir, err := ioutil.TempDir("", "sectionctl-*")
-	if err != nil {
-		return err
-	}
-	log.Debug().Msg(fmt.Sprintln("tempDir: ", tempDir))
-	// Git objects storer based on memory
-	gitAuth := &gitHTTP.BasicAuth{
-		Username: "section-token", // yes, this can be anything except an empty string
-		Password: api.Token,
-	}
-	payload := PayloadValue{ID: response.PayloadID}
-	branchRef := fmt.Sprintf("refs/heads/%s",c.Environment)
-	var r *git.Repository
-	progressOutput := logWriters.CarriageReturnWriter
-	log.Info().Msg(fmt.Sprintln("Cloning section config repo for your application to ",tempDir))
-	r, err = git.PlainClone(tempDir, false, &git.CloneOptions{
-		URL:      cloneDir,
-		Auth:     gitAuth,
-		Progress: progressOutput,
-		ReferenceName: plumbing.ReferenceName(branchRef),
-	})
-	
+	u := *api.PrefixURI
+	u.Path = path.Join("/", u.Path, fmt.Sprintf("account/%d/application/%d/%s.git", c.AccountID, c.AppID, appName))
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// errCloneTooLarge is returned when a clone outgrows the memory it is allowed
+var errCloneTooLarge = errors.New("environment repository is too large to clone into memory")
+
+// cappedStorage is memory storage for a clone that fails once its objects outgrow limit bytes
+type cappedStorage struct {
+	*memory.Storage
+	limit int64
+	size  int64
+}
+
+// SetEncodedObject stores an object, failing if the storage is full
+func (s *cappedStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.size += obj.Size()
+	if s.size > s.limit {
+		return plumbing.ZeroHash, errCloneTooLarge
+	}
+	return s.Storage.SetEncodedObject(obj)
+}
+
+// cloneEnvironmentRepo clones the branch of the application repository for c.Environment.
+//
+// With a depth, only that many commits of history are fetched. The clone is kept in memory,
+// unless it grows beyond --clone-memory-mb, when it's cloned to a temporary directory instead.
+// Close must be called to clean up after the clone.
+func cloneEnvironmentRepo(c *DeployCmd, logWriters *LogWriters, depth int) (er *environmentRepo, err error) {
+	er = &environmentRepo{depth: depth}
+	er.url, err = environmentRepoURL(c)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(er.url, "file://") {
+		installFileProtocol()
+	}
+	if strings.HasPrefix(er.url, "http://") || strings.HasPrefix(er.url, "https://") {
+		er.auth = &gitHTTP.BasicAuth{
+			Username: "section-token", // yes, this can be anything except an empty string
+			Password: api.Token,
+		}
+	}
+	opts := &git.CloneOptions{
+		URL:           er.url,
+		Auth:          er.auth,
+		Progress:      logWriters.CarriageReturnWriter,
+		ReferenceName: plumbing.NewBranchReferenceName(c.Environment),
+		SingleBranch:  true,
+		Depth:         depth,
+	}
+	log.Info().Msg("Cloning section config repo for your application")
+	er.repo, err = er.clone(c, opts)
+	if err != nil && opts.Depth > 0 && strings.Contains(err.Error(), "capability: shallow") {
+		log.Debug().Err(err).Msg("The environment repository doesn't support shallow clones, cloning all of it")
+		opts.Depth, er.depth = 0, 0
+		er.repo, err = er.clone(c, opts)
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("error cloning")
+		return nil, err
+	}
+	return er, nil
+}
+
+// clone clones into memory, falling back to a temporary directory if the clone is too large
+func (er *environmentRepo) clone(c *DeployCmd, opts *git.CloneOptions) (r *git.Repository, err error) {
+	start := time.Now()
+	if c.CloneMemoryMB > 0 {
+		storage := &cappedStorage{Storage: memory.NewStorage(), limit: int64(c.CloneMemoryMB) * 1024 * 1024}
+		r, err = git.Clone(storage, memfs.New(), opts)
+		if err == nil {
+			log.Debug().Dur("Duration", time.Since(start)).Int64("Size", storage.size).Int("Depth", opts.Depth).Msg("Cloned environment repository into memory")
+			return r, nil
+		}
+		if !errors.Is(err, errCloneTooLarge) {
+			return nil, err
+		}
+		log.Debug().Int("Limit MB", c.CloneMemoryMB).Msg("Environment repository is too large for memory, cloning it to disk")
+	}
+
+	er.dir, err = ioutil.TempDir("", "sectionctl-*")
+	if err != nil {
+		return nil, err
+	}
+	log.Debug().Msg(fmt.Sprintln("tempDir: ", er.dir))
+	r, err = git.PlainClone(er.dir, false, opts)
+	if err != nil {
+		er.Close()
+		er.dir = ""
+		return nil, err
+	}
+	log.Debug().Dur("Duration", time.Since(start)).Int("Depth", opts.Depth).Msg("Cloned environment repository to disk")
+	return r, nil
+}
+
+// Close removes the clone's temporary directory, if it has one
+func (er *environmentRepo) Close() error {
+	if er.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(er.dir)
+}
+
+// OpenDeploy clones the application repository for a deploy, so the payload it records can be
+// checked before uploading, and the new one recorded after, without cloning it again
+func (g *GS) OpenDeploy(c *DeployCmd, logWriters *LogWriters) (DeployTarget, error) {
+	er, err := cloneEnvironmentRepo(c, logWriters, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &deployTarget{er: er, c: c, logWriters: logWriters}, nil
+}
+
+// deployTarget is an environment repository cloned for a deploy
+type deployTarget struct {
+	er         *environmentRepo
+	c          *DeployCmd
+	logWriters *LogWriters
+}
+
+// Current returns the payload currently recorded for the module
+func (t *deployTarget) Current() (PayloadValue, error) {
+	return currentPayload(t.er.repo, externalSourcePath(t.c))
+}
+
+// SectionConfig returns the environment's section.config.json, or nil if it has none
+func (t *deployTarget) SectionConfig() (*SectionConfigJSON, error) {
+	contents, err := configFile(t.er.repo, "section.config.json")
+	if err != nil || contents == nil {
+		return nil, err
+	}
+	sc, err := ParseSectionConfig(string(contents))
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Record updates the clone with the uploaded payload and pushes a new commit. If the
+// environment changed since it was cloned, the change is re-applied on top, see commitPayload.
+func (t *deployTarget) Record(response UploadResponse) error {
+	log.Debug().Msg(fmt.Sprintf(" Begin updating hash in .section-external-source.json:\n\tsection-configmap-tars/%v/%s.tar.gz\n", t.c.AccountID, response.PayloadID))
+	message := t.c.Message
+	if message == "" {
+		message = fmt.Sprintf("[sectionctl] updated %s with new deployment.", externalSourcePath(t.c))
+	}
+	message = withTrailers(message, deployTrailers(t.c, response.SHA256))
+	return commitPayload(t.er, t.c, PayloadValue{ID: response.PayloadID, SHA256: response.SHA256}, message, t.logWriters)
+}
+
+// Close cleans up after the clone
+func (t *deployTarget) Close() error {
+	return t.er.Close()
+}
+
+// currentPayload reads the payload recorded in the file at path at HEAD
+func currentPayload(r *git.Repository, path string) (pv PayloadValue, err error) {
+	ref, err := r.Head()
+	if err != nil {
+		return pv, fmt.Errorf("error retrieving the git HEAD: %w", err)
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return pv, err
+	}
+	f, err := commit.File(path)
+	if err != nil {
+		return pv, err
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return pv, fmt.Errorf("couldn't open contents of file: %w", err)
+	}
+	err = json.Unmarshal([]byte(content), &pv)
+	return pv, err
+}
+
+// headPayload returns the payload recorded in the file at path at HEAD, with the HEAD commit.
+//
+// Unlike payloadHistory, it doesn't need the repository's history, so works in a shallow clone.
+func headPayload(r *git.Repository, path string) (PayloadHistoryEntry, error) {
+	ref, err := r.Head()
+	if err != nil {
+		return PayloadHistoryEntry{}, fmt.Errorf("error retrieving the git HEAD: %w", err)
+	}
+	cm, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return PayloadHistoryEntry{}, err
+	}
+	pv, err := currentPayload(r, path)
+	if err != nil {
+		return PayloadHistoryEntry{}, err
+	}
+	message, trailers := parseTrailers(cm.Message)
+	return PayloadHistoryEntry{
+		Commit:      cm.Hash.String(),
+		When:        cm.Author.When,
+		AuthorName:  cm.Author.Name,
+		AuthorEmail: cm.Author.Email,
+		Message:     message,
+		Trailers:    trailers,
+		PayloadID:   pv.ID,
+		SHA256:      pv.SHA256,
+	}, nil
+}
+
+// PayloadHistory returns the payloads deployed to an app environment, most recent first
+func (g *GS) PayloadHistory(c *DeployCmd, logWriters *LogWriters) ([]PayloadHistoryEntry, error) {
+	er, err := cloneEnvironmentRepo(c, logWriters, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer er.Close()
+	return payloadHistory(er.repo, externalSourcePath(c))
+}
+
+// Rollback restores an earlier payload in an app environment by pushing a new commit recording it.
+//
+// If payloadID is empty, the payload deployed before the current one is restored.
+func (g *GS) Rollback(c *DeployCmd, payloadID string, logWriters *LogWriters) (PayloadHistoryEntry, error) {
+	er, err := cloneEnvironmentRepo(c, logWriters, 0)
+	if err != nil {
+		return PayloadHistoryEntry{}, err
+	}
+	defer er.Close()
+	history, err := payloadHistory(er.repo, externalSourcePath(c))
+	if err != nil {
+		return PayloadHistoryEntry{}, err
+	}
+	target, err := rollbackTarget(history, payloadID)
+	if err != nil {
+		return target, err
+	}
+	msg := c.Message
+	if msg == "" {
+		msg = fmt.Sprintf("[sectionctl] rolled back %s to payload %s from commit %.7s.", externalSourcePath(c), target.PayloadID, target.Commit)
+	}
+	trailers := map[string]string{trailerVersion: version.Version}
+	if target.SHA256 != "" {
+		trailers[trailerPayloadHash] = target.SHA256
+	}
+	msg = withTrailers(msg, trailers)
+	return target, commitPayload(er, c, PayloadValue{ID: target.PayloadID, SHA256: target.SHA256}, msg, logWriters)
+}
+
+// payloadHistory walks the log of the file at path, returning the payload recorded by each commit that changed it
+func payloadHistory(r *git.Repository, path string) (entries []PayloadHistoryEntry, err error) {
+	ref, err := r.Head()
+	if err != nil {
+		return entries, fmt.Errorf("error retrieving the git HEAD: %w", err)
+	}
+	iter, err := r.Log(&git.LogOptions{From: ref.Hash(), FileName: &path, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return entries, err
+	}
+	err = iter.ForEach(func(cm *object.Commit) error {
+		f, err := cm.File(path)
+		if err != nil {
+			return nil // removed in this commit
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("couldn't open contents of file: %w", err)
+		}
+		var pv PayloadValue
+		if err := json.Unmarshal([]byte(content), &pv); err != nil {
+			log.Debug().Err(err).Str("commit", cm.Hash.String()).Msg("unable to decode payload")
+			return nil
+		}
+		message, trailers := parseTrailers(cm.Message)
+		entries = append(entries, PayloadHistoryEntry{
+			Commit:      cm.Hash.String(),
+			When:        cm.Author.When,
+			AuthorName:  cm.Author.Name,
+			AuthorEmail: cm.Author.Email,
+			Message:     message,
+			Trailers:    trailers,
+			PayloadID:   pv.ID,
+			SHA256:      pv.SHA256,
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// rollbackTarget picks the entry to roll back to from history, most recent first.
+//
+// If payloadID is empty, the most recent payload that differs from the current one is picked.
+func rollbackTarget(history []PayloadHistoryEntry, payloadID string) (PayloadHistoryEntry, error) {
+	if len(history) == 0 {
+		return PayloadHistoryEntry{}, fmt.Errorf("no deploys found in the environment history")
+	}
+	current := history[0].PayloadID
+	if payloadID == current {
+		return PayloadHistoryEntry{}, fmt.Errorf("payload %s is already deployed", payloadID)
+	}
+	for _, e := range history[1:] {
+		if e.PayloadID == current {
+			continue
+		}
+		if payloadID == "" || e.PayloadID == payloadID {
+			return e, nil
+		}
+	}
+	if payloadID == "" {
+		return PayloadHistoryEntry{}, fmt.Errorf("no earlier deploy to roll back to")
+	}
+	return PayloadHistoryEntry{}, fmt.Errorf("payload %s not found in the environment history", payloadID)
+}
+
+// concurrentDeployError is returned when another deploy recorded a payload in the environment
+// repository while this one was in progress
+type concurrentDeployError struct {
+	latest    PayloadHistoryEntry
+	payloadID string
+}
+
+func (e *concurrentDeployError) Error() string {
+	return fmt.Sprintf("another deploy recorded payload %s (commit %.7s by %s at %s) while this one was in progress, so payload %s was not deployed. Deploy again, or use --replace-concurrent to replace it",
+		e.latest.PayloadID, e.latest.Commit, e.latest.AuthorName, e.latest.When.Format(time.RFC3339), e.payloadID)
+}
+
+// isRejectedPush reports whether a push failed because the branch moved on since it was fetched
+func isRejectedPush(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "non-fast-forward") || strings.Contains(msg, "fetch first") || strings.Contains(msg, "cannot lock ref")
+}
+
+// commitPayload records payload in the environment repository clone, then commits and pushes the change.
+//
+// If the push is rejected because the branch changed in the meantime, the branch is fetched again
+// and the change re-applied on top of it, up to --push-retries times. If the change was another
+// deploy to the same module, a concurrentDeployError is returned, unless --replace-concurrent is set.
+func commitPayload(er *environmentRepo, c *DeployCmd, payload PayloadValue, message string, logWriters *LogWriters) error {
+	base, err := currentPayload(er.repo, externalSourcePath(c))
+	if err != nil {
 		return err
 	}
+	author := commitAuthor()
+	for attempt := 0; ; attempt++ {
+		err = commitPayloadFile(er, c, payload, message, author)
+		if err != nil {
+			return err
+		}
+		if attempt == 0 {
+			logDeployTarget(er, c, payload.ID)
+			log.Info().Msg("Validating your app...")
+		}
+		err = er.repo.Push(&git.PushOptions{Auth: er.auth, Progress: logWriters.CarriageReturnWriter})
+		if err == nil {
+			return nil
+		}
+		if !isRejectedPush(err) || attempt >= c.PushRetries {
+			return fmt.Errorf("failed to push git changes: %w", err)
+		}
+		log.Warn().Err(err).Int("Attempt", attempt+1).Msg("The environment repository changed during the deploy, fetching it and trying again")
+
+		err = er.reset(c, logWriters)
+		if err != nil {
+			return fmt.Errorf("failed to fetch git changes: %w", err)
+		}
+		latest, err := headPayload(er.repo, externalSourcePath(c))
+		if err != nil {
+			return err
+		}
+		if latest.PayloadID == payload.ID && latest.SHA256 == payload.SHA256 {
+			log.Info().Str("Commit", latest.Commit).Msg(fmt.Sprintf("Payload %s was already recorded by another deploy", payload.ID))
+			return nil
+		}
+		if latest.PayloadID != base.ID || latest.SHA256 != base.SHA256 {
+			if !c.ReplaceConcurrent {
+				return &concurrentDeployError{latest: latest, payloadID: payload.ID}
+			}
+			log.Warn().Str("Commit", latest.Commit).Msg(fmt.Sprintf("Replacing payload %s, recorded by another deploy, because of --replace-concurrent", latest.PayloadID))
+			base = PayloadValue{ID: latest.PayloadID, SHA256: latest.SHA256}
+		}
+	}
+}
+
+// reset fetches the environment branch, and resets the clone to it, dropping the local commit
+func (er *environmentRepo) reset(c *DeployCmd, logWriters *LogWriters) error {
+	branch := plumbing.NewBranchReferenceName(c.Environment)
+	remote := plumbing.NewRemoteReferenceName("origin", c.Environment)
+	w, err := er.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	// drop the local commit first, so it isn't offered to the remote while fetching
+	err = er.resetTo(w, remote)
+	if err != nil {
+		return err
+	}
+	err = er.repo.Fetch(&git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", branch, remote))},
+		Auth:     er.auth,
+		Progress: logWriters.CarriageReturnWriter,
+		Depth:    er.depth,
+		Force:    true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return er.resetTo(w, remote)
+}
+
+// resetTo hard resets the worktree and its branch to the commit name refers to
+func (er *environmentRepo) resetTo(w *git.Worktree, name plumbing.ReferenceName) error {
+	ref, err := er.repo.Reference(name, true)
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{Commit: ref.Hash(), Mode: git.HardReset})
+}
+
+// commitAuthor returns the authenticated user to author deploy commits, falling back to sectionctl
+func commitAuthor() object.Signature {
+	author := object.Signature{Name: "sectionctl", Email: "noreply@section.io"}
+	u, err := api.CurrentUser()
+	if err != nil {
+		log.Debug().Err(err).Msg("Unable to look up the current user to author the deploy")
+		return author
+	}
+	if u.Email == "" {
+		return author
+	}
+	author.Email = u.Email
+	author.Name = strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if author.Name == "" {
+		author.Name = u.Email
+	}
+	return author
+}
+
+// commitPayloadFile writes payload to the module's .section-external-source.json and commits it
+func commitPayloadFile(er *environmentRepo, c *DeployCmd, payload PayloadValue, message string, author object.Signature) error {
+	r := er.repo
 	// ... retrieving the branch being pointed by HEAD
 	ref, err := r.Head()
 	if err != nil {
@@ -85,7 +565,7 @@ func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadRes
 	if err != nil {
 		return err
 	}
-	f, err := tree.File(c.AppPath + "/.section-external-source.json")
+	f, err := tree.File(externalSourcePath(c))
 	if err != nil {
 		return err
 	}
@@ -98,18 +578,19 @@ func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadRes
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal json: %w", err)
 	}
-	log.Debug().Str("Old tarball UUID",  content);
-	log.Debug().Str("New tarball UUID",  response.PayloadID)
+	log.Debug().Str("Old tarball UUID", content)
+	log.Debug().Str("New tarball UUID", payload.ID)
 	srcContent.ID = payload.ID
+	srcContent.SHA256 = payload.SHA256
 	pl, err := json.MarshalIndent(srcContent, "", "\t")
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(filepath.Join(tempDir, c.AppPath+"/.section-external-source.json"), pl, 0644)
+	err = util.WriteFile(w.Filesystem, externalSourcePath(c), pl, 0644)
 	if err != nil {
 		return err
 	}
-	_, err = w.Add(c.AppPath + "/.section-external-source.json")
+	_, err = w.Add(externalSourcePath(c))
 	if err != nil {
 		return err
 	}
@@ -119,15 +600,15 @@ func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadRes
 		return err
 	}
 	log.Debug().Msg(fmt.Sprintln("git status: ", status))
-	_, err = w.Add(c.AppPath + "/.section-external-source.json")
-	if err != nil {
-		return err
-	}
-	commitHash, err := w.Commit("[sectionctl] updated nodejs/.section-external-source.json with new deployment.", &git.CommitOptions{Author: &object.Signature{
-		Name:  "sectionctl",
-		Email: "noreply@section.io",
-		When:  time.Now(),
-	}})
+	author.When = time.Now()
+	commitHash, err := w.Commit(message, &git.CommitOptions{
+		Author: &author,
+		Committer: &object.Signature{
+			Name:  "sectionctl",
+			Email: "noreply@section.io",
+			When:  author.When,
+		},
+	})
 	if err != nil {
 		return fmt.Errorf("failed to make a commit on the temporary repository: %w", err)
 	}
@@ -140,7 +621,7 @@ func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadRes
 	if err != nil {
 		return err
 	}
-	newF, err := newTree.File(c.AppPath + "/.section-external-source.json")
+	newF, err := newTree.File(externalSourcePath(c))
 	if err != nil {
 		return err
 	}
@@ -150,44 +631,48 @@ func (g *GS) UpdateGitViaGit(ctx *kong.Context, c *DeployCmd, response UploadRes
 		return fmt.Errorf("could not open contents of new file in git: %w", err)
 	}
 	log.Debug().Msg(fmt.Sprintln("contents in new commit: ", ctt))
-	
-	configFile, err := tree.File("section.config.json")
-	if err != nil {
-		log.Error().Err(err).Msg("unable to open section.config.json which is used to log the image name and version")
+	return nil
+}
+
+// logDeployTarget logs where the payload is being deployed to, including the module's image from section.config.json
+func logDeployTarget(er *environmentRepo, c *DeployCmd, payloadID string) {
+	moduleVersion := "unknown"
+	var sectionConfigContents string
+	configFile, err := headFile(er.repo, "section.config.json")
+	if err == nil {
+		sectionConfigContents, err = configFile.Contents()
 	}
-	sectionConfigContents, err := configFile.Contents()
 	if err != nil {
 		log.Error().Err(err).Msg("unable to open section.config.json which is used to log the image name and version")
-	}
-	sectionConfig, err := ParseSectionConfig(sectionConfigContents)
-	if err != nil{
-		log.Error().Err(err).Msg("There was an issue reading the section.config.json")
-	}
-	// if err := json.Unmarshal(sectionConfigContent.Bytes(), &sectionConfig); err != nil {
-	// 	log.Error().Err(err).Msg("unable to decode the json for section.config.json which is used to log the image name and version")
-	// }
-	moduleVersion := "unknown"
-	for _,v := range sectionConfig.Proxychain{
-		if(v.Name == c.AppPath){
-			moduleVersion = v.Image
+	} else {
+		sectionConfig, err := ParseSectionConfig(sectionConfigContents)
+		if err != nil {
+			log.Error().Err(err).Msg("There was an issue reading the section.config.json")
+		}
+		for _, v := range sectionConfig.Proxychain {
+			if v.Name == c.AppPath {
+				moduleVersion = v.Image
+			}
 		}
 	}
-	if moduleVersion == "unknown"{
+	if moduleVersion == "unknown" {
 		log.Debug().Msg("failed to pair app path (aka proxy name) with image (version)")
 	}
-	// for proxy, _ := range sectionConfig["proxychain"]{
-
-	// }
-	log.Info().Str("Git Remote",cloneDir).Msg("")
-	log.Info().Str("Tarball Source",fmt.Sprintf("%v/%s.tar.gz",c.AccountID,response.PayloadID)).Msg("")
-	log.Info().Str("Module Name",c.AppPath).Msg("")
-	log.Info().Str("Module Version",moduleVersion).Msg("")
-	log.Info().Msg("Validating your app...")
-	err = r.Push(&git.PushOptions{Auth: gitAuth, Progress: progressOutput})
+	log.Info().Str("Git Remote", er.url).Msg("")
+	log.Info().Str("Tarball Source", fmt.Sprintf("%v/%s.tar.gz", c.AccountID, payloadID)).Msg("")
+	log.Info().Str("Module Name", c.AppPath).Msg("")
+	log.Info().Str("Module Version", moduleVersion).Msg("")
+}
 
+// headFile returns the file at path in the HEAD commit
+func headFile(r *git.Repository, path string) (*object.File, error) {
+	ref, err := r.Head()
 	if err != nil {
-		return fmt.Errorf("failed to push git changes: %w", err)
+		return nil, err
 	}
-	
-	return nil
-}
\ No newline at end of file
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return commit.File(path)
+}
@@ -0,0 +1,436 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/file"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// helperEnvironmentRemote creates a local bare repository standing in for an app's environment
+// repository, with a dev branch that has payload "one" deployed to the nodejs module.
+func helperEnvironmentRemote(t *testing.T) (remote string, bare string) {
+	installFileProtocol()
+	seed := t.TempDir()
+	r, err := git.PlainInit(seed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectionConfig := `{"proxychain": [{"name": "varnish", "image": "varnish:6.0"}, {"name": "nodejs", "image": "nodejs-basic:14.17.0"}]}`
+	if err := ioutil.WriteFile(filepath.Join(seed, "section.config.json"), []byte(sectionConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("section.config.json"); err != nil {
+		t.Fatal(err)
+	}
+	helperCommitPayload(t, r, seed, "one", time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	bare = t.TempDir()
+	if _, err := git.PlainInit(bare, true); err != nil {
+		t.Fatal(err)
+	}
+	remote = "file://" + filepath.ToSlash(bare)
+	helperPushBranch(t, r, remote, "dev")
+	return remote, bare
+}
+
+// helperPushBranch pushes the HEAD of r to branch on remote
+func helperPushBranch(t *testing.T, r *git.Repository, remote string, branch string) {
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:refs/heads/%s", head.Name(), branch))},
+	})
+	if err == git.ErrRemoteNotFound {
+		_, err = r.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remote}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		helperPushBranch(t, r, remote, branch)
+		return
+	}
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		t.Fatal(err)
+	}
+}
+
+// helperBranchPayload reads the payload recorded for the nodejs module on branch of the repository at dir
+// helperRecordPayload records a payload in the environment repository the way a deploy does
+func helperRecordPayload(t *testing.T, c *DeployCmd, response UploadResponse, logWriters *LogWriters) error {
+	t.Helper()
+	target, err := (&GS{}).OpenDeploy(c, logWriters)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	return target.Record(response)
+}
+
+func helperBranchPayload(t *testing.T, dir string, branch string) (pv PayloadValue, message string) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := commit.File("nodejs/.section-external-source.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(contents), &pv); err != nil {
+		t.Fatal(err)
+	}
+	return pv, commit.Message
+}
+
+func TestCommandsDeployEnvironmentRepoURL(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2", "/proxy/api/v1/account/1/application/2":
+			fmt.Fprint(w, `{"id": 2, "application_name": "www.example.com"}`)
+		case "/api/v1/account/1/application/2/environment", "/proxy/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	api.MaxAttempts = 1
+
+	var testCases = []struct {
+		name      string
+		prefix    string
+		gitRemote string
+		want      string
+	}{
+		{"from the API prefix", ts.URL, "", ts.URL + "/account/1/application/2/www.example.com.git"},
+		{"from an API prefix with a path", ts.URL + "/proxy", "", ts.URL + "/proxy/account/1/application/2/www.example.com.git"},
+		{"overridden", ts.URL, "file:///srv/git/env.git", "file:///srv/git/env.git"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := url.Parse(tc.prefix)
+			assert.NoError(err)
+			api.PrefixURI = u
+			c := DeployCmd{AccountID: 1, AppID: 2, GitRemote: tc.gitRemote}
+
+			// Invoke
+			got, err := environmentRepoURL(&c)
+
+			// Test
+			assert.NoError(err)
+			assert.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestCommandsDeployGitServiceUpdatesEnvironmentRepo(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, bare := helperEnvironmentRemote(t)
+	c := DeployCmd{GitRemote: remote, Environment: "dev", AppPath: "nodejs", CloneMemoryMB: 256}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	g := &GS{}
+
+	// Invoke
+	target, openErr := g.OpenDeploy(&c, &logWriters)
+	if !assert.NoError(openErr) {
+		return
+	}
+	before, beforeErr := target.Current()
+	updateErr := target.Record(UploadResponse{PayloadID: "two", SHA256: "abc123"})
+	assert.NoError(target.Close())
+	after, message := helperBranchPayload(t, bare, "dev")
+	history, historyErr := g.PayloadHistory(&c, &logWriters)
+
+	// Test
+	assert.NoError(beforeErr)
+	assert.Equal("one", before.ID)
+	assert.NoError(updateErr)
+	assert.Equal(PayloadValue{ID: "two", SHA256: "abc123"}, after)
+	assert.Contains(message, "updated nodejs/.section-external-source.json")
+	assert.NoError(historyErr)
+	if assert.Len(history, 2) {
+		assert.Equal("two", history[0].PayloadID)
+		assert.Equal("one", history[1].PayloadID)
+	}
+}
+
+func TestCommandsDeployGitServiceRollsBackEnvironmentRepo(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, bare := helperEnvironmentRemote(t)
+	c := DeployCmd{GitRemote: remote, Environment: "dev", AppPath: "nodejs", CloneMemoryMB: 256}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	g := &GS{}
+	assert.NoError(helperRecordPayload(t, &c, UploadResponse{PayloadID: "two"}, &logWriters))
+
+	// Invoke
+	target, err := g.Rollback(&c, "", &logWriters)
+	after, message := helperBranchPayload(t, bare, "dev")
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("one", target.PayloadID)
+	assert.Equal("one", after.ID)
+	assert.Contains(message, "rolled back")
+}
+
+func TestCommandsDeployGitServiceRequiresEnvironmentBranch(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, _ := helperEnvironmentRemote(t)
+	c := DeployCmd{GitRemote: remote, Environment: "Production", AppPath: "nodejs"}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	err := helperRecordPayload(t, &c, UploadResponse{PayloadID: "two"}, &logWriters)
+
+	// Test
+	assert.Error(err)
+}
+
+func TestCommandsDeployRecordsPayloadInEnvironmentRepo(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, string(helperLoadBytes(t, "deploy/upload.response.with_success.json")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = u
+	api.MaxAttempts = 1
+	remote, bare := helperEnvironmentRemote(t)
+	globalGitService = &GS{}
+	defer func() { globalGitService = &MockGitService{} }()
+
+	dir := filepath.Join("testdata", "deploy", "valid-nodejs-app")
+	c := DeployCmd{Directory: dir, ServerURL: u, AccountID: 100, AppID: 200, Environment: "dev", Kind: "nodejs", GitRemote: remote}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	err = c.Deploy(&CLI{}, &kong.Context{}, &logWriters)
+
+	// Test
+	assert.NoError(err)
+	payload, _ := helperBranchPayload(t, bare, "dev")
+	assert.Equal("1234", payload.ID)
+	assert.Len(payload.SHA256, 64)
+}
+
+// helperConcurrentCommit commits contents to path on the dev branch of remote from another clone,
+// as another pipeline would
+func helperConcurrentCommit(t *testing.T, remote string, path string, contents string) {
+	dir := t.TempDir()
+	r, err := git.PlainClone(dir, false, &git.CloneOptions{URL: remote, ReferenceName: plumbing.NewBranchReferenceName("dev")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, filepath.FromSlash(path))), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(path)), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Commit("concurrent change to "+path, &git.CommitOptions{Author: &object.Signature{Name: "Grace", Email: "grace@hopper.example", When: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Push(&git.PushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandsDeployCommitPayloadRetriesRejectedPush(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		path        string
+		contents    string
+		force       bool
+		replace     bool
+		pushRetries int
+		want        string
+		err         string
+	}{
+		{"unrelated change is kept", "section.config.json", `{"proxychain": []}`, false, false, 3, "two", ""},
+		{"newer payload is reported", "nodejs/.section-external-source.json", `{"section_payload_id": "three"}`, false, false, 3, "three", "another deploy recorded payload three"},
+		{"newer payload is reported with force", "nodejs/.section-external-source.json", `{"section_payload_id": "three"}`, true, false, 3, "three", "another deploy recorded payload three"},
+		{"newer payload is replaced with replace-concurrent", "nodejs/.section-external-source.json", `{"section_payload_id": "three"}`, false, true, 3, "two", ""},
+		{"same payload is left alone", "nodejs/.section-external-source.json", `{"section_payload_id": "two"}`, false, false, 3, "two", ""},
+		{"retries run out", "section.config.json", `{"proxychain": []}`, false, false, 0, "one", "failed to push git changes"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			remote, bare := helperEnvironmentRemote(t)
+			c := DeployCmd{GitRemote: remote, Environment: "dev", AppPath: "nodejs", Force: tc.force, ReplaceConcurrent: tc.replace, PushRetries: tc.pushRetries, CloneMemoryMB: 256}
+			logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+			er, err := cloneEnvironmentRepo(&c, &logWriters, 1)
+			assert.NoError(err)
+			defer er.Close()
+			helperConcurrentCommit(t, remote, tc.path, tc.contents)
+
+			// Invoke
+			err = commitPayload(er, &c, PayloadValue{ID: "two"}, "deploy two", &logWriters)
+
+			// Test
+			if tc.err != "" {
+				if assert.Error(err) {
+					assert.Contains(err.Error(), tc.err)
+				}
+			} else {
+				assert.NoError(err)
+			}
+			payload, _ := helperBranchPayload(t, bare, "dev")
+			assert.Equal(tc.want, payload.ID)
+			if tc.name == "unrelated change is kept" {
+				r, err := git.PlainOpen(bare)
+				assert.NoError(err)
+				ref, err := r.Reference(plumbing.NewBranchReferenceName("dev"), true)
+				assert.NoError(err)
+				commit, err := r.CommitObject(ref.Hash())
+				assert.NoError(err)
+				f, err := commit.File("section.config.json")
+				assert.NoError(err)
+				contents, _ := f.Contents()
+				assert.Equal(tc.contents, contents)
+			}
+		})
+	}
+}
+
+func TestCommandsDeployCloneEnvironmentRepoIsShallowAndInMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	// the in-process file:// server can't make shallow clones, so use git's own
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	client.InstallProtocol("file", file.DefaultClient)
+	defer client.InstallProtocol("file", server.DefaultServer)
+	remote, bare := helperEnvironmentRemote(t)
+	for _, id := range []string{"two", "three"} {
+		helperConcurrentCommit(t, remote, "nodejs/.section-external-source.json", `{"section_payload_id": "`+id+`"}`)
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	c := DeployCmd{GitRemote: remote, Environment: "dev", AppPath: "nodejs", CloneMemoryMB: 256}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	er, err := cloneEnvironmentRepo(&c, &logWriters, 1)
+	if !assert.NoError(err) {
+		return
+	}
+	defer er.Close()
+	shallow, shallowErr := er.repo.Storer.Shallow()
+	commitErr := commitPayload(er, &c, PayloadValue{ID: "four"}, "deploy four", &logWriters)
+
+	// Test
+	assert.Empty(er.dir, "the clone is in memory")
+	assert.NoError(shallowErr)
+	assert.Len(shallow, 1, "only the latest commit is cloned")
+	assert.NoError(commitErr)
+	payload, _ := helperBranchPayload(t, bare, "dev")
+	assert.Equal("four", payload.ID)
+	left, err := ioutil.ReadDir(tmp)
+	assert.NoError(err)
+	assert.Empty(left, "nothing is written to disk")
+}
+
+func TestCommandsDeployCloneEnvironmentRepoFallsBackToDisk(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	remote, _ := helperEnvironmentRemote(t)
+	big := make([]byte, 2*1024*1024)
+	rand.New(rand.NewSource(1)).Read(big)
+	helperConcurrentCommit(t, remote, "big.bin", string(big))
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	c := DeployCmd{GitRemote: remote, Environment: "dev", AppPath: "nodejs", CloneMemoryMB: 1}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+	// Invoke
+	er, err := cloneEnvironmentRepo(&c, &logWriters, 1)
+	if !assert.NoError(err) {
+		return
+	}
+	dir := er.dir
+	current, currentErr := currentPayload(er.repo, externalSourcePath(&c))
+	closeErr := er.Close()
+	updateErr := helperRecordPayload(t, &c, UploadResponse{PayloadID: "two"}, &logWriters)
+
+	// Test
+	assert.NotEmpty(dir, "the clone is on disk")
+	assert.Equal(tmp, filepath.Dir(dir))
+	assert.NoError(currentErr)
+	assert.Equal("one", current.ID)
+	assert.NoError(closeErr)
+	assert.NoError(updateErr)
+	left, err := ioutil.ReadDir(tmp)
+	assert.NoError(err)
+	assert.Empty(left, "temporary clones are removed")
+}
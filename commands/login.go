@@ -20,12 +20,12 @@ type LoginCmd struct {
 }
 
 // Run executes the command
-func (c *LoginCmd) Run() (err error) {
+func (c *LoginCmd) Run(cli *CLI) (err error) {
 	screenshot := "https://raw.githubusercontent.com/section/sectionctl/main/docs/section_token_control_panel.png"
 	windowsStr := fmt.Sprintf("Unable to write credential.\n\nPlease execute the following, add it to your Powershell profile, or add it to your environment variables in control panel: \nWith Powershell:\n$env:SECTION_TOKEN=\"%s\"\n\nWith CMD:\nset SECTION_TOKEN=%s\n\nWith control panel:\n%s", api.Token, api.Token, screenshot)
 	linuxStr := fmt.Sprintf("Unable to write credential.\n\nPlease run this command, and add it to your ~/.bashrc (you do not need to run sectionctl login again)\n\nexport SECTION_TOKEN=%s", api.Token)
 	if api.Token != "" {
-		err = credentials.Write(api.PrefixURI.Host, api.Token)
+		err = credentials.Write(cli.TokenKey(), api.Token)
 		if err != nil {
 			if runtime.GOOS == "windows" {
 				fmt.Print(windowsStr)
@@ -35,7 +35,7 @@ func (c *LoginCmd) Run() (err error) {
 			return nil
 		}
 	} else {
-		t, err := credentials.PromptAndWrite(c.In(), c.Out(), api.PrefixURI.Host)
+		t, err := credentials.PromptAndWrite(c.In(), c.Out(), cli.TokenKey())
 		if err != nil {
 			if runtime.GOOS == "windows" {
 				fmt.Printf("Unable to write credential.\n\nPlease execute the following, add it to your Powershell profile, or add it to your environment variables in control panel: \nWith Powershell:\n$env:SECTION_TOKEN=\"%s\"\n\nWith CMD:\nset SECTION_TOKEN=%s\n\nWith control panel:\n%s", t, t, screenshot)
@@ -39,7 +39,7 @@ func TestCommandsLoginValidatesGoodCredentials(t *testing.T) {
 	}
 
 	// Invoke
-	err = cmd.Run()
+	err = cmd.Run(&CLI{})
 
 	// Test
 	assert.NoError(err)
@@ -69,7 +69,7 @@ func TestCommandsLoginValidatesBadCredentials(t *testing.T) {
 	}
 
 	// Invoke
-	err = cmd.Run()
+	err = cmd.Run(&CLI{})
 
 	// Test
 	assert.Error(err)
@@ -106,7 +106,7 @@ func TestCommandsLoginUsesAlreadySetAPIToken(t *testing.T) {
 
 
 	// Invoke
-	err = cmd.Run()
+	err = cmd.Run(&CLI{})
 
 	// Test
 	assert.NoError(err)
@@ -11,10 +11,10 @@ import (
 type LogoutCmd struct{}
 
 // Run executes the command
-func (c *LogoutCmd) Run(logWriters *LogWriters) (err error) {
+func (c *LogoutCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 	s := NewSpinner(fmt.Sprintf("Revoking your authentication for %s", api.PrefixURI.Host), logWriters)
 	s.Start()
-	err = credentials.Delete(api.PrefixURI.Host)
+	err = credentials.Delete(cli.TokenKey())
 	s.Stop()
 	return err
 }
@@ -1,8 +1,15 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/logrusorgru/aurora" // colorable
@@ -13,76 +20,301 @@ import (
 // maxNumberLogs
 const maxNumberLogs = 1500
 
+// defaultNumberLogs is the number of lines fetched when no --number or time range is given
+const defaultNumberLogs = 100
+
 // LogsCmd returns logs from an application on Section's delivery platform
 type LogsCmd struct {
-	AccountID    int    `required short:"a" help:"ID of account to query"`
-	AppID        int    `required short:"i" help:"ID of app to query"`
-	AppPath      string `default:"nodejs" help:"Path of NodeJS application in environment repository."`
-	InstanceName string `default:"" help:"Specific instance of NodeJS application running on Section platform."`
-	Number       int    `short:"n" default:100 help:"Number of log lines to fetch."`
-	Follow       bool   `help:"Displays recent logs and leaves the session open for logs to stream in. --instance-name required."`
-	// StartTimestamp  int    `default:0 help:"Start of log time stamp to fetch."`
-	// EndTimestamp    int    `default:0 help:"End of log time stamp to fetch."`
+	AccountID    int           `required short:"a" help:"ID of account to query"`
+	AppID        int           `required short:"i" help:"ID of app to query"`
+	Environment  string        `short:"e" default:"Production" help:"Environment to query. (name of git branch ie: Production, staging, development)"`
+	AppPath      string        `default:"nodejs" help:"Path of NodeJS application in environment repository."`
+	InstanceName string        `default:"" help:"Specific instance of NodeJS application running on Section platform. Defaults to all instances."`
+	Number       int           `short:"n" help:"Number of log lines to show. Defaults to 100, or every line in the time range given by --since or --from. Within a time range, only lines passing --type and --grep are counted. Without one, the last n lines are fetched, then filtered."`
+	Follow       bool          `short:"f" help:"Displays recent logs and leaves the session open for logs from all instances to stream in."`
+	Transport    string        `enum:"auto,poll,subscription" default:"auto" help:"How --follow receives new logs: a subscription, polling, or auto to subscribe where the API allows and poll otherwise."`
+	Since        time.Duration `help:"Show logs written in this long before now, e.g. 2h or 15m."`
+	From         string        `help:"Show logs written from this time, as RFC3339 (2021-06-01T10:00:00Z) or a duration before now (2h)."`
+	To           string        `help:"Show logs written up to this time, as RFC3339 or a duration before now. Defaults to now."`
+	Type         string        `enum:"app,access," default:"" help:"Only show logs of this type: app or access."`
+	Grep         string        `help:"Only show log lines whose message matches this regular expression."`
+	Access       bool          `help:"Only show access logs. Shorthand for --type access."`
+	Summary      bool          `help:"Instead of printing access logs, summarize them: requests by status code, the most requested paths, and latency percentiles over time."`
+	Window       time.Duration `default:"1m" help:"Length of the windows latency percentiles are calculated over, with --summary."`
+	Top          int           `default:"10" help:"Number of paths shown with --summary."`
+	Export       string        `help:"Write logs to this file as NDJSON instead of printing them. Exports resume after the last line already written to the file." type:"path"`
+	ExportGzip   bool          `help:"Gzip the export. Implied when the --export file name ends in .gz."`
+	ExportMaxMB  int           `name:"export-max-mb" help:"Rotate the export file when it grows past this many megabytes, moving it aside with a timestamp in its name."`
 }
 
 // Run executes the command
 func (c *LogsCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
+	return c.run(cli, logWriters, os.Stdout)
+}
+
+// run shows the logs, writing summaries to out
+func (c *LogsCmd) run(cli *CLI, logWriters *LogWriters, out io.Writer) (err error) {
+	if c.Access {
+		if c.Type != "" && c.Type != "access" {
+			return fmt.Errorf("--access can't be used with --type %s", c.Type)
+		}
+		c.Type = "access"
+	}
+	if c.Export != "" && c.Summary {
+		return fmt.Errorf("--export can't be used with --summary")
+	}
+	if c.Summary {
+		if c.Follow {
+			return fmt.Errorf("--summary can't be used with --follow")
+		}
+		if c.Window <= 0 {
+			return fmt.Errorf("--window must be positive")
+		}
+		c.Type = "access"
+	}
+	from, to, err := c.timeRange(time.Now())
+	if err != nil {
+		return err
+	}
+	match, err := c.matcher(to)
+	if err != nil {
+		return err
+	}
+	var export *logExporter
+	if c.Export != "" {
+		var environmentID int
+		environmentID, err = api.EnvironmentID(c.AccountID, c.AppID, c.Environment)
+		if err != nil {
+			return fmt.Errorf("unable to look up the %s environment: %w", c.Environment, err)
+		}
+		export, err = newLogExporter(c, environmentID)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := export.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+			log.Info().Msgf("Exported %d log lines to %s", export.written, c.Export)
+		}()
+		if resume := export.ResumeFrom(); !resume.IsZero() {
+			log.Info().Msgf("Resuming export after %s", resume.Format(time.RFC3339Nano))
+			from = resume
+		}
+	}
+	if from.IsZero() && c.Number > maxNumberLogs {
+		return fmt.Errorf("number of logs queried cannot be over %d without --since or --from", maxNumberLogs)
+	}
+
 	s := NewSpinner("Getting logs from app",logWriters)
 	logsHeader := "\nInstanceName[Log Type]\t\t\tLog Message\n"
 	s.FinalMSG = logsHeader
+	if c.Summary || export != nil {
+		s.FinalMSG = ""
+	}
 	s.Start()
 
-	if c.Number > maxNumberLogs {
-		return fmt.Errorf("number of logs queried cannot be over %d", maxNumberLogs)
-	}
+	// quiet only silences printed log lines, summaries and exports are still wanted
+	if !bool(cli.Quiet) || c.Summary || export != nil {
+		var appLogs []api.AppLogs
+		if from.IsZero() {
+			number := c.Number
+			if number == 0 {
+				number = defaultNumberLogs
+			}
+			appLogs, err = api.ApplicationLogs(c.AccountID, c.AppID, c.Environment, c.AppPath, c.InstanceName, number, "")
+		} else {
+			appLogs, err = fetchLogRange(c, from, to, c.Number, match)
+		}
+		s.Stop()
+		if err != nil {
+			return err
+		}
+		if c.Summary {
+			var matched []api.AppLogs
+			for _, l := range appLogs {
+				if match(l) {
+					matched = append(matched, l)
+				}
+			}
+			summary := SummarizeAccessLogs(matched, c.Window, c.Top)
+			if ok, err := WriteStructured(cli, out, summary); ok {
+				return err
+			}
+			printAccessLogSummary(out, summary)
+			return nil
+		}
+		f := newLogFollower(c, func(l api.AppLogs) error {
+			if match(l) {
+				printLog(l)
+			}
+			return nil
+		})
+		if export != nil {
+			f.print = func(l api.AppLogs) error {
+				if match(l) {
+					return export.Write(l)
+				}
+				return nil
+			}
+			f.flush = export.Flush
+		}
+		if _, err := f.add(appLogs); err != nil {
+			return err
+		}
+		if !c.Follow {
+			return nil
+		}
 
-	var startTimestampRfc3339 string
-	if c.Follow {
 		log.Debug().Msg(fmt.Sprintln("Following logs..."))
-		if c.InstanceName == "" {
-			return fmt.Errorf("--instance-name is required when using --follow")
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return f.Run(ctx)
+	}
+	s.Stop()
+	return nil
+}
+
+// timeRange returns the start and end of the logs asked for, which are zero when not given
+func (c *LogsCmd) timeRange(now time.Time) (from, to time.Time, err error) {
+	if c.Since > 0 && c.From != "" {
+		return from, to, fmt.Errorf("--since and --from can't be used together")
+	}
+	if c.Since > 0 {
+		from = now.Add(-c.Since)
+	}
+	if c.From != "" {
+		from, err = parseLogTime(c.From, now)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid --from: %w", err)
 		}
-		startTimestampRfc3339 = time.Now().Format(time.RFC3339)
 	}
+	if c.To != "" {
+		if from.IsZero() {
+			return from, to, fmt.Errorf("--to requires --since or --from")
+		}
+		if c.Follow {
+			return from, to, fmt.Errorf("--to can't be used with --follow")
+		}
+		to, err = parseLogTime(c.To, now)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid --to: %w", err)
+		}
+		if !to.After(from) {
+			return from, to, fmt.Errorf("--to must be after the start of the time range")
+		}
+	}
+	return from, to, nil
+}
 
-	if !(cli.Quiet) {
-		for {
-			appLogs, err := api.ApplicationLogs(c.AccountID, c.AppID, c.AppPath, c.InstanceName, c.Number, startTimestampRfc3339)
-			s.Stop()
-			if err != nil {
-				return err
-			}
-			var latestTimestamp string
-			for _, a := range appLogs {
-				a.Message = strings.TrimSpace(a.Message)
-
-				if a.Type == "app" {
-					log.Info().Msg(fmt.Sprintf("%s%s\t%s", aurora.Cyan(a.InstanceName), aurora.Cyan("["+a.Type+"]"), a.Message))
-				} else if a.Type == "access" {
-					log.Info().Msg(fmt.Sprintf("%s%s\t%s", aurora.Green(a.InstanceName), aurora.Green("["+a.Type+"]"), a.Message))
-				} else {
-					log.Info().Msg(fmt.Sprintf("%s[%s]\t%s", a.InstanceName, a.Type, a.Message))
-				}
-				if a.Timestamp != "" {
-					latestTimestamp = a.Timestamp
-				}
+// matcher returns a function reporting whether a log line passes the --type, --grep and --to filters
+func (c *LogsCmd) matcher(to time.Time) (func(api.AppLogs) bool, error) {
+	var re *regexp.Regexp
+	if c.Grep != "" {
+		var err error
+		re, err = regexp.Compile(c.Grep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --grep: %w", err)
+		}
+	}
+	return func(l api.AppLogs) bool {
+		if c.Type != "" && l.Type != c.Type {
+			return false
+		}
+		if re != nil && !re.MatchString(l.Message) {
+			return false
+		}
+		if !to.IsZero() && logTime(l).After(to) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// parseLogTime parses an RFC3339 time, or a duration before now such as 2h
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither an RFC3339 time nor a duration", s)
+	}
+	return t, nil
+}
+
+// fetchLogRange fetches the logs written between from and to, paging through the API
+// maxNumberLogs lines at a time. A zero to means up to now.
+//
+// Fetching stops once limit lines pass match, or carries on to the end of the range if limit is zero.
+// Lines that don't pass match are returned too, so callers see everything fetched.
+func fetchLogRange(c *LogsCmd, from, to time.Time, limit int, match func(api.AppLogs) bool) (logs []api.AppLogs, err error) {
+	seen := map[logKey]bool{}
+	matched := 0
+	cursor := from
+	for {
+		// the API's start time has second precision, so pages overlap by up to a second
+		start := cursor.Truncate(time.Second)
+		page, err := api.ApplicationLogs(c.AccountID, c.AppID, c.Environment, c.AppPath, c.InstanceName, maxNumberLogs, start.Format(time.RFC3339))
+		if err != nil {
+			return logs, err
+		}
+		log.Debug().Int("Lines", len(page)).Str("Start", start.Format(time.RFC3339)).Msg("Fetched page of logs")
+		sort.SliceStable(page, func(i, j int) bool {
+			return logTime(page[i]).Before(logTime(page[j]))
+		})
+
+		next := cursor
+		ended := false
+		for _, l := range page {
+			ts := logTime(l)
+			if ts.Before(from) {
+				continue
 			}
-			if !c.Follow {
+			if !to.IsZero() && ts.After(to) {
+				ended = true
 				break
 			}
-			if latestTimestamp == "" {
-				latestTimestamp = startTimestampRfc3339
+			if ts.After(next) {
+				next = ts
 			}
-			t, err := time.Parse(time.RFC3339, latestTimestamp)
-			if err == nil {
-				t = t.Add(time.Second)
-				startTimestampRfc3339 = t.Format(time.RFC3339)
+			k := logKey{instance: l.InstanceName, timestamp: l.Timestamp, message: l.Message}
+			if seen[k] {
+				continue
 			}
-			s.Prefix = ""
-			s.FinalMSG = ""
-			s.Start()
-			time.Sleep(5 * time.Second)
+			seen[k] = true
+			logs = append(logs, l)
+			if match(l) {
+				matched++
+			}
+			if limit > 0 && matched >= limit {
+				return logs, nil
+			}
+		}
+		if ended || len(page) < maxNumberLogs {
+			return logs, nil
 		}
+		if !next.Truncate(time.Second).After(start) {
+			// a full page within one second, the rest of that second can't be fetched
+			log.Warn().Str("Timestamp", start.Format(time.RFC3339)).Msgf("More than %d log lines in one second, some may be missing", maxNumberLogs)
+			next = start.Add(time.Second)
+		}
+		cursor = next
+	}
+}
+
+// printLog prints a log line, coloured by its type
+func printLog(a api.AppLogs) {
+	a.Message = strings.TrimSpace(a.Message)
+
+	if a.Type == "app" {
+		log.Info().Msg(fmt.Sprintf("%s%s\t%s", aurora.Cyan(a.InstanceName), aurora.Cyan("["+a.Type+"]"), a.Message))
+	} else if a.Type == "access" {
+		log.Info().Msg(fmt.Sprintf("%s%s\t%s", aurora.Green(a.InstanceName), aurora.Green("["+a.Type+"]"), a.Message))
+	} else {
+		log.Info().Msg(fmt.Sprintf("%s[%s]\t%s", a.InstanceName, a.Type, a.Message))
 	}
-	return nil
 }
@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/section/sectionctl/api"
+)
+
+// LogRecord is a log line as written by logs --export, one JSON object per line.
+//
+// Environments can be renamed, so records carry the environment's ID as well as its name.
+type LogRecord struct {
+	Timestamp     string `json:"timestamp"`
+	Instance      string `json:"instance"`
+	Type          string `json:"type"`
+	Message       string `json:"message"`
+	AccountID     int    `json:"accountId"`
+	AppID         int    `json:"appId"`
+	EnvironmentID int    `json:"environmentId"`
+	Environment   string `json:"environment"`
+}
+
+// exportState records how far an export has got, so it can be resumed without
+// losing or duplicating lines. It is kept next to the export in <file>.state.
+type exportState struct {
+	// LastTimestamp is the newest timestamp exported
+	LastTimestamp string `json:"lastTimestamp"`
+	// Exported identifies the lines exported with LastTimestamp, as several lines can share it
+	Exported []string `json:"exported"`
+	// Size is the size of the export file when the state was saved. Anything after it was
+	// written after the last flush, so isn't recorded here, and is dropped when resuming.
+	Size *int64 `json:"size,omitempty"`
+	// Member is the gzip member left open at the end of the export file, if there is one
+	Member *gzipMember `json:"member,omitempty"`
+}
+
+// gzipMember describes what was written to a gzip member, so its trailer can be written if
+// the export is stopped before it's closed
+type gzipMember struct {
+	CRC32 uint32 `json:"crc32"`
+	Size  uint32 `json:"size"`
+}
+
+// logExporter writes log lines to a file as NDJSON, optionally gzipped and rotated by size
+type logExporter struct {
+	c             *LogsCmd
+	environmentID int
+	path          string
+	gzip          bool
+	maxSize       int64
+
+	file   *os.File
+	size   int64
+	gz     *gzip.Writer
+	member gzipMember
+	// memberStart is the offset of the gzip member being written
+	memberStart int64
+	out         io.Writer
+	state       exportState
+	last        time.Time
+	written     int
+}
+
+// newLogExporter opens the export file named by --export for appending.
+//
+// Files ending in .gz are gzipped. As gzip streams can be concatenated, appending
+// to an existing gzipped export keeps it readable. If the export was stopped without
+// being closed, it's first truncated to the last flush, and its open gzip member closed.
+func newLogExporter(c *LogsCmd, environmentID int) (*logExporter, error) {
+	e := &logExporter{
+		c:             c,
+		environmentID: environmentID,
+		path:          c.Export,
+		gzip:          c.ExportGzip || strings.HasSuffix(c.Export, ".gz"),
+		maxSize:       int64(c.ExportMaxMB) * 1024 * 1024,
+	}
+	b, err := os.ReadFile(e.statePath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &e.state); err != nil {
+			return nil, fmt.Errorf("unable to read export state %s: %w", e.statePath(), err)
+		}
+		e.last, _ = time.Parse(time.RFC3339Nano, e.state.LastTimestamp)
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("unable to read export state: %w", err)
+	}
+	if err := e.repair(); err != nil {
+		return nil, err
+	}
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// repair truncates the export file to its size when the state was last saved, and terminates
+// the gzip member left open there, so appending to the file keeps it readable
+func (e *logExporter) repair() error {
+	if e.state.Size == nil {
+		return nil
+	}
+	f, err := os.OpenFile(e.path, os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open export file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < *e.state.Size {
+		// the file isn't the one the state was saved for, so leave it be
+		return nil
+	}
+	if info.Size() > *e.state.Size {
+		if err := f.Truncate(*e.state.Size); err != nil {
+			return fmt.Errorf("unable to drop unflushed lines from export file: %w", err)
+		}
+	}
+	if e.state.Member == nil {
+		return nil
+	}
+	// the member was flushed, so its deflate stream ends on a byte boundary, where it can be
+	// finished with an empty final stored block, followed by the member's trailer
+	trailer := []byte{0x01, 0x00, 0x00, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(trailer[5:], e.state.Member.CRC32)
+	binary.LittleEndian.PutUint32(trailer[9:], e.state.Member.Size)
+	if _, err := f.WriteAt(trailer, *e.state.Size); err != nil {
+		return fmt.Errorf("unable to close gzip member of export file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	e.state.Member = nil
+	return nil
+}
+
+// ResumeFrom returns the newest timestamp already exported, or the zero time for a new export
+func (e *logExporter) ResumeFrom() time.Time {
+	return e.last
+}
+
+// Write exports a log line, skipping lines exported before
+func (e *logExporter) Write(l api.AppLogs) error {
+	ts := logTime(l)
+	key := exportKey(l)
+	if !e.last.IsZero() && !ts.IsZero() {
+		if ts.Before(e.last) {
+			return nil
+		}
+		if ts.Equal(e.last) {
+			for _, k := range e.state.Exported {
+				if k == key {
+					return nil
+				}
+			}
+		}
+	}
+
+	b, err := json.Marshal(LogRecord{
+		Timestamp:     l.Timestamp,
+		Instance:      l.InstanceName,
+		Type:          l.Type,
+		Message:       strings.TrimRight(l.Message, "\r\n"),
+		AccountID:     e.c.AccountID,
+		AppID:         e.c.AppID,
+		EnvironmentID: e.environmentID,
+		Environment:   e.c.Environment,
+	})
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if _, err := e.out.Write(b); err != nil {
+		return fmt.Errorf("unable to write to %s: %w", e.path, err)
+	}
+	e.member.CRC32 = crc32.Update(e.member.CRC32, crc32.IEEETable, b)
+	e.member.Size += uint32(len(b))
+	e.written++
+
+	if !ts.IsZero() {
+		if ts.After(e.last) {
+			e.last = ts
+			e.state = exportState{LastTimestamp: l.Timestamp}
+		}
+		e.state.Exported = append(e.state.Exported, key)
+	}
+	return nil
+}
+
+// Flush makes everything written so far durable, records the export's progress,
+// and rotates the file if it has grown past the size limit.
+func (e *logExporter) Flush() error {
+	if e.gz != nil {
+		if err := e.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := e.file.Sync(); err != nil {
+		return err
+	}
+	if err := e.saveState(); err != nil {
+		return err
+	}
+	if e.maxSize > 0 && e.size >= e.maxSize {
+		if err := e.rotate(); err != nil {
+			return err
+		}
+		return e.saveState()
+	}
+	return nil
+}
+
+// Close closes the export, and records its progress
+func (e *logExporter) Close() error {
+	if e.gz != nil {
+		if err := e.gz.Close(); err != nil {
+			e.file.Close()
+			return err
+		}
+		e.gz = nil
+	}
+	if err := e.file.Sync(); err != nil {
+		e.file.Close()
+		return err
+	}
+	if err := e.saveState(); err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
+
+func (e *logExporter) open() error {
+	f, err := os.OpenFile(e.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open export file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	e.file = f
+	e.size = info.Size()
+	var w io.Writer = &sizeWriter{w: f, n: &e.size}
+	e.gz = nil
+	e.member = gzipMember{}
+	e.memberStart = e.size
+	if e.gzip {
+		e.gz = gzip.NewWriter(w)
+		w = e.gz
+	}
+	e.out = w
+	return nil
+}
+
+// rotate moves the full export aside, named after the time of rotation, and starts a new file
+func (e *logExporter) rotate() error {
+	if e.gz != nil {
+		if err := e.gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := e.file.Close(); err != nil {
+		return err
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	rotated := rotatedPath(e.path, stamp)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotated); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		rotated = rotatedPath(e.path, fmt.Sprintf("%s-%d", stamp, i))
+	}
+	if err := os.Rename(e.path, rotated); err != nil {
+		return fmt.Errorf("unable to rotate export file: %w", err)
+	}
+	return e.open()
+}
+
+func (e *logExporter) statePath() string {
+	return e.path + ".state"
+}
+
+func (e *logExporter) saveState() error {
+	size := e.size
+	e.state.Size = &size
+	e.state.Member = nil
+	// gzip members are only written once there's something in them
+	if e.gz != nil && e.size > e.memberStart {
+		member := e.member
+		e.state.Member = &member
+	}
+	b, err := json.Marshal(e.state)
+	if err != nil {
+		return err
+	}
+	tmp := e.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.statePath())
+}
+
+// rotatedPath inserts stamp before the extensions of path, so logs.ndjson.gz
+// becomes logs-20210601T100000Z.ndjson.gz
+func rotatedPath(path string, stamp string) string {
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, ext = base[:i], base[i:]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, stamp, ext))
+}
+
+// exportKey identifies a log line among those sharing its timestamp
+func exportKey(l api.AppLogs) string {
+	sum := sha256.Sum256([]byte(l.InstanceName + "\x00" + l.Timestamp + "\x00" + l.Message))
+	return fmt.Sprintf("%x", sum[:12])
+}
+
+// sizeWriter counts the bytes written through it
+type sizeWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (s *sizeWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	*s.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func helperReadExport(t *testing.T, path string, gzipped bool) (records []LogRecord) {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		r, err = gzip.NewReader(f)
+		assert.NoError(t, err)
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var rec LogRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	assert.NoError(t, scanner.Err())
+	return records
+}
+
+func TestCommandsLogsExportResumesWithoutDuplicates(t *testing.T) {
+	for _, name := range []string{"logs.ndjson", "logs.ndjson.gz"} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", Export: filepath.Join(t.TempDir(), name)}
+			first := []api.AppLogs{
+				{Timestamp: "2021-06-01T10:00:00Z", InstanceName: "nodejs-a", Type: "app", Message: "one\n"},
+				{Timestamp: "2021-06-01T10:00:01Z", InstanceName: "nodejs-a", Type: "app", Message: "two"},
+			}
+			second := []api.AppLogs{
+				{Timestamp: "2021-06-01T10:00:01Z", InstanceName: "nodejs-a", Type: "app", Message: "two"},
+				{Timestamp: "2021-06-01T10:00:01Z", InstanceName: "nodejs-b", Type: "access", Message: "three"},
+				{Timestamp: "2021-06-01T10:00:02Z", InstanceName: "nodejs-a", Type: "app", Message: "four"},
+			}
+
+			// Invoke
+			e, err := newLogExporter(&c, 10)
+			assert.NoError(err)
+			for _, l := range first {
+				assert.NoError(e.Write(l))
+			}
+			assert.NoError(e.Close())
+
+			e, err = newLogExporter(&c, 10)
+			assert.NoError(err)
+			assert.Equal("2021-06-01T10:00:01Z", e.ResumeFrom().Format("2006-01-02T15:04:05Z07:00"))
+			for _, l := range append(first, second...) {
+				assert.NoError(e.Write(l))
+			}
+			assert.NoError(e.Close())
+
+			// Test
+			records := helperReadExport(t, c.Export, filepath.Ext(name) == ".gz")
+			var messages []string
+			for _, r := range records {
+				messages = append(messages, r.Message)
+			}
+			assert.Equal([]string{"one", "two", "three", "four"}, messages)
+			assert.Equal(LogRecord{Timestamp: "2021-06-01T10:00:01Z", Instance: "nodejs-b", Type: "access", Message: "three", AccountID: 1, AppID: 2, EnvironmentID: 10, Environment: "Production"}, records[2])
+		})
+	}
+}
+
+func TestCommandsLogsExportResumesAfterKill(t *testing.T) {
+	for _, name := range []string{"logs.ndjson", "logs.ndjson.gz"} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", Export: filepath.Join(t.TempDir(), name)}
+			flushed := []api.AppLogs{
+				{Timestamp: "2021-06-01T10:00:00Z", InstanceName: "nodejs-a", Type: "app", Message: "one"},
+				{Timestamp: "2021-06-01T10:00:01Z", InstanceName: "nodejs-a", Type: "app", Message: "two"},
+			}
+			unflushed := []api.AppLogs{
+				{Timestamp: "2021-06-01T10:00:02Z", InstanceName: "nodejs-a", Type: "app", Message: "three"},
+			}
+			later := []api.AppLogs{
+				{Timestamp: "2021-06-01T10:00:03Z", InstanceName: "nodejs-a", Type: "app", Message: "four"},
+			}
+
+			// Invoke
+			e, err := newLogExporter(&c, 10)
+			assert.NoError(err)
+			for _, l := range flushed {
+				assert.NoError(e.Write(l))
+			}
+			assert.NoError(e.Flush())
+			// killed after more lines reached the file, but before the state recorded them
+			for _, l := range unflushed {
+				assert.NoError(e.Write(l))
+			}
+			if e.gz != nil {
+				assert.NoError(e.gz.Flush())
+			}
+			_, err = e.file.Write([]byte{0x42})
+			assert.NoError(err)
+			assert.NoError(e.file.Close())
+
+			e, err = newLogExporter(&c, 10)
+			assert.NoError(err)
+			for _, l := range append(append(flushed, unflushed...), later...) {
+				assert.NoError(e.Write(l))
+			}
+			assert.NoError(e.Close())
+
+			// Test
+			records := helperReadExport(t, c.Export, filepath.Ext(name) == ".gz")
+			var messages []string
+			for _, r := range records {
+				messages = append(messages, r.Message)
+			}
+			assert.Equal([]string{"one", "two", "three", "four"}, messages)
+		})
+	}
+}
+
+func TestCommandsLogsExportRotatesBySize(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	dir := t.TempDir()
+	c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", Export: filepath.Join(dir, "logs.ndjson"), ExportMaxMB: 1}
+	e, err := newLogExporter(&c, 10)
+	assert.NoError(err)
+	e.maxSize = 200
+	f := newLogFollower(&c, e.Write)
+	f.flush = e.Flush
+
+	// Invoke
+	_, err = f.add([]api.AppLogs{{Timestamp: "2021-06-01T10:00:00Z", InstanceName: "nodejs-a", Message: "one"}, {Timestamp: "2021-06-01T10:00:01Z", InstanceName: "nodejs-a", Message: "two"}})
+	assert.NoError(err)
+	_, err = f.add([]api.AppLogs{{Timestamp: "2021-06-01T10:00:02Z", InstanceName: "nodejs-a", Message: "three"}})
+	assert.NoError(err)
+	assert.NoError(e.Close())
+
+	// Test
+	rotated, err := filepath.Glob(filepath.Join(dir, "logs-*.ndjson"))
+	assert.NoError(err)
+	assert.Len(rotated, 1)
+	assert.Len(helperReadExport(t, rotated[0], false), 2)
+	assert.Len(helperReadExport(t, c.Export, false), 1)
+}
+
+func TestCommandsLogsExportRotatedPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(filepath.Join("out", "logs-20210601T100000Z.ndjson.gz"), rotatedPath(filepath.Join("out", "logs.ndjson.gz"), "20210601T100000Z"))
+	assert.Equal("logs-20210601T100000Z", rotatedPath("logs", "20210601T100000Z"))
+}
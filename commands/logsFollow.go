@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/api"
+)
+
+var (
+	// followMinInterval is the polling interval while logs are arriving
+	followMinInterval = 1 * time.Second
+	// followMaxInterval caps the polling interval when logs are quiet or the API is failing
+	followMaxInterval = 30 * time.Second
+)
+
+const (
+	followTransportAuto         = "auto"
+	followTransportPoll         = "poll"
+	followTransportSubscription = "subscription"
+)
+
+// logKey identifies a log line, as lines from different instances, or repeated
+// lines from one instance, can share a timestamp.
+type logKey struct {
+	instance  string
+	timestamp string
+	message   string
+}
+
+// logFollower prints new log lines for an app environment as they are written.
+//
+// Lines are deduplicated, so the same line returned by overlapping queries, or by
+// both a subscription and polling, is printed once.
+type logFollower struct {
+	c *LogsCmd
+	// print outputs a new line
+	print func(api.AppLogs) error
+	// flush, if set, is called after each batch of new lines
+	flush func() error
+
+	seen   map[logKey]time.Time
+	cursor time.Time
+}
+
+func newLogFollower(c *LogsCmd, print func(api.AppLogs) error) *logFollower {
+	return &logFollower{
+		c:     c,
+		print: print,
+		seen:  map[logKey]time.Time{},
+	}
+}
+
+// Run follows logs until ctx is done, the API rejects our credentials, or a line can't be printed.
+//
+// It uses a subscription where the API supports one, and polls otherwise. Once subscribed, it
+// queries for lines written since the cursor, as the subscription only carries later ones.
+func (f *logFollower) Run(ctx context.Context) error {
+	if f.cursor.IsZero() {
+		f.cursor = time.Now()
+	}
+	if f.c.Transport != followTransportPoll {
+		var printErr error
+		backfill := func() error {
+			logs, err := f.fetch()
+			if err != nil {
+				log.Warn().Err(err).Msg("Unable to fetch logs written before subscribing")
+				return nil
+			}
+			_, printErr = f.add(logs)
+			return printErr
+		}
+		err := api.SubscribeApplicationLogs(ctx, f.c.AccountID, f.c.AppID, f.c.Environment, f.c.AppPath, f.c.InstanceName, backfill, func(l api.AppLogs) error {
+			_, printErr = f.add([]api.AppLogs{l})
+			return printErr
+		})
+		switch {
+		case printErr != nil:
+			return printErr
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, api.ErrAuthDenied):
+			return err
+		case f.c.Transport == followTransportSubscription:
+			return err
+		case errors.Is(err, api.ErrSubscriptionsUnsupported):
+			log.Debug().Err(err).Msg("Falling back to polling for logs")
+		case err != nil:
+			log.Warn().Err(err).Msg("Log subscription ended, polling for logs instead")
+		}
+	}
+	return f.poll(ctx)
+}
+
+// poll queries for logs since the newest line seen, polling more often while lines
+// are arriving and backing off while they aren't or the API is failing.
+func (f *logFollower) poll(ctx context.Context) error {
+	interval := followMinInterval
+	failures := 0
+	for {
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+
+		logs, err := f.fetch()
+		if err != nil {
+			if errors.Is(err, api.ErrAuthDenied) {
+				return err
+			}
+			failures++
+			interval = nextFollowInterval(interval, false)
+			log.Warn().Err(err).Int("Failures", failures).Dur("Retrying in", interval).Msg("Unable to fetch logs")
+			continue
+		}
+		if failures > 0 {
+			log.Info().Msg("Fetching logs again")
+			failures = 0
+		}
+		n, err := f.add(logs)
+		if err != nil {
+			return err
+		}
+		interval = nextFollowInterval(interval, n > 0)
+	}
+}
+
+// fetch queries for logs since the newest line seen
+func (f *logFollower) fetch() ([]api.AppLogs, error) {
+	// query from the start of the cursor's second, as that's the API's precision
+	start := f.cursor.Truncate(time.Second).Format(time.RFC3339)
+	return api.ApplicationLogs(f.c.AccountID, f.c.AppID, f.c.Environment, f.c.AppPath, f.c.InstanceName, maxNumberLogs, start)
+}
+
+// add prints the lines not seen before, oldest first, and returns how many were printed
+func (f *logFollower) add(logs []api.AppLogs) (n int, err error) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logTime(logs[i]).Before(logTime(logs[j]))
+	})
+	for _, l := range logs {
+		k := logKey{instance: l.InstanceName, timestamp: l.Timestamp, message: l.Message}
+		if _, ok := f.seen[k]; ok {
+			continue
+		}
+		ts := logTime(l)
+		if ts.After(f.cursor) {
+			f.cursor = ts
+		}
+		// lines without a timestamp are remembered until the cursor moves on
+		if ts.IsZero() {
+			ts = f.cursor
+		}
+		f.seen[k] = ts
+		if err := f.print(l); err != nil {
+			return n, err
+		}
+		n++
+	}
+	f.prune()
+	if f.flush != nil && n > 0 {
+		return n, f.flush()
+	}
+	return n, nil
+}
+
+// prune forgets lines older than the cursor's second, as later queries can't return them
+func (f *logFollower) prune() {
+	floor := f.cursor.Truncate(time.Second)
+	for k, ts := range f.seen {
+		if ts.Before(floor) {
+			delete(f.seen, k)
+		}
+	}
+}
+
+// nextFollowInterval shortens the polling interval when there was new output, and lengthens it otherwise
+func nextFollowInterval(current time.Duration, active bool) time.Duration {
+	if active {
+		return followMinInterval
+	}
+	next := current * 2
+	if next > followMaxInterval {
+		next = followMaxInterval
+	}
+	return next
+}
+
+// logTime parses a log line's timestamp, returning the zero time if it has none
+func logTime(l api.AppLogs) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, l.Timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestCommandsLogsFollowDeduplicatesAndSurvivesErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	responses := []string{
+		`[{"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-a", "type": "app", "message": "one"}, {"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-b", "type": "app", "message": "one"}]`,
+		"error",
+		`[{"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-a", "type": "app", "message": "one"}, {"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-a", "type": "app", "message": "two"}, {"timestamp": "2021-06-01T10:00:01Z", "instanceName": "nodejs-b", "type": "app", "message": "three"}]`,
+		`[{"timestamp": "2021-06-01T10:00:01Z", "instanceName": "nodejs-b", "type": "app", "message": "three"}]`,
+	}
+	var mu sync.Mutex
+	var polls int
+	var starts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		case "/new/authorized/graphql_api/query":
+			mu.Lock()
+			defer mu.Unlock()
+			b, err := ioutil.ReadAll(r.Body)
+			assert.NoError(err)
+			if i := strings.Index(string(b), `"startTimestampRfc3339":"`); i >= 0 {
+				starts = append(starts, string(b[i+25:i+45]))
+			}
+			i := polls
+			if i >= len(responses) {
+				i = len(responses) - 1
+			}
+			polls++
+			if responses[i] == "error" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			fmt.Fprintf(w, `{"data": {"logs": %s}}`, responses[i])
+		default:
+			assert.FailNowf("unhandled URL", "URL: %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+	defer func(a int) { api.MaxAttempts = a }(api.MaxAttempts)
+	api.MaxAttempts = 1
+	defer func(min, max time.Duration) { followMinInterval, followMaxInterval = min, max }(followMinInterval, followMaxInterval)
+	followMinInterval, followMaxInterval = time.Millisecond, 5*time.Millisecond
+
+	c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", Transport: followTransportPoll}
+	ctx, cancel := context.WithCancel(context.Background())
+	var printed []string
+	f := newLogFollower(&c, func(l api.AppLogs) error {
+		printed = append(printed, l.InstanceName+":"+l.Message)
+		if len(printed) == 4 {
+			cancel()
+		}
+		return nil
+	})
+	f.cursor, _ = time.Parse(time.RFC3339, "2021-06-01T09:59:59Z")
+
+	// Invoke
+	err = f.Run(ctx)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal([]string{"nodejs-a:one", "nodejs-b:one", "nodejs-a:two", "nodejs-b:three"}, printed)
+	assert.Equal("2021-06-01T09:59:59Z", starts[0])
+	assert.Equal("2021-06-01T10:00:00Z", starts[len(starts)-1])
+}
+
+func TestCommandsLogsFollowStopsWhenUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+	defer func(min time.Duration) { followMinInterval = min }(followMinInterval)
+	followMinInterval = time.Millisecond
+
+	c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", Transport: followTransportAuto}
+	f := newLogFollower(&c, func(l api.AppLogs) error { return nil })
+
+	// Invoke
+	err = f.Run(context.Background())
+
+	// Test
+	assert.ErrorIs(err, api.ErrAuthDenied)
+}
+
+func TestCommandsLogsFollowBackfillsOnceSubscribed(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var queriedAfterStart bool
+	started := make(chan struct{})
+	ws := websocket.Server{Handler: func(ws *websocket.Conn) {
+		var msg map[string]interface{}
+		assert.NoError(websocket.JSON.Receive(ws, &msg))
+		assert.NoError(websocket.JSON.Send(ws, map[string]string{"type": "connection_ack"}))
+		assert.NoError(websocket.JSON.Receive(ws, &msg))
+		assert.Equal("start", msg["type"])
+		close(started)
+		assert.NoError(websocket.JSON.Send(ws, map[string]interface{}{"id": "1", "type": "data", "payload": json.RawMessage(`{"data": {"logs": [{"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-a", "message": "before"}, {"timestamp": "2021-06-01T10:00:01Z", "instanceName": "nodejs-a", "message": "after"}]}}`)}))
+		assert.NoError(websocket.JSON.Send(ws, map[string]string{"id": "1", "type": "complete"}))
+	}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		case r.Header.Get("Upgrade") == "websocket":
+			ws.ServeHTTP(w, r)
+		default:
+			select {
+			case <-started:
+				queriedAfterStart = true
+			default:
+			}
+			fmt.Fprint(w, `{"data": {"logs": [{"timestamp": "2021-06-01T10:00:00Z", "instanceName": "nodejs-a", "message": "before"}]}}`)
+		}
+	}))
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+
+	c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", Transport: followTransportSubscription}
+	var printed []string
+	f := newLogFollower(&c, func(l api.AppLogs) error {
+		printed = append(printed, l.Message)
+		return nil
+	})
+	f.cursor, _ = time.Parse(time.RFC3339, "2021-06-01T09:59:59Z")
+
+	// Invoke
+	err = f.Run(context.Background())
+
+	// Test
+	assert.NoError(err)
+	assert.True(queriedAfterStart)
+	assert.Equal([]string{"before", "after"}, printed)
+}
+
+func TestCommandsLogsFollowForgetsLinesWithoutTimestamps(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	f := newLogFollower(&LogsCmd{}, func(l api.AppLogs) error { return nil })
+	f.cursor, _ = time.Parse(time.RFC3339, "2021-06-01T10:00:00Z")
+
+	// Invoke
+	_, err := f.add([]api.AppLogs{{InstanceName: "nodejs-a", Message: "no timestamp"}})
+	assert.NoError(err)
+	remembered := len(f.seen)
+	_, err = f.add([]api.AppLogs{{InstanceName: "nodejs-a", Timestamp: "2021-06-01T10:00:02Z", Message: "later"}})
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(1, remembered)
+	assert.Len(f.seen, 1)
+}
+
+func TestCommandsLogsNextFollowInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(followMinInterval, nextFollowInterval(8*time.Second, true))
+	assert.Equal(4*time.Second, nextFollowInterval(2*time.Second, false))
+	assert.Equal(followMaxInterval, nextFollowInterval(followMaxInterval, false))
+}
@@ -0,0 +1,226 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsLogsParseLogTime(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	var testCases = []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"now", now, false},
+		{"2021-06-01T10:30:00Z", time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert := assert.New(t)
+			got, err := parseLogTime(tc.input, now)
+			if tc.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.True(tc.want.Equal(got), "want %s, got %s", tc.want, got)
+		})
+	}
+}
+
+func TestCommandsLogsTimeRangeValidatesFlags(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	from, to, err := (&LogsCmd{Since: time.Hour}).timeRange(now)
+	assert.NoError(err)
+	assert.Equal(now.Add(-time.Hour), from)
+	assert.True(to.IsZero())
+
+	from, to, err = (&LogsCmd{From: "3h", To: "1h"}).timeRange(now)
+	assert.NoError(err)
+	assert.Equal(now.Add(-3*time.Hour), from)
+	assert.Equal(now.Add(-time.Hour), to)
+
+	_, _, err = (&LogsCmd{Since: time.Hour, From: "2h"}).timeRange(now)
+	assert.Error(err)
+	_, _, err = (&LogsCmd{To: "1h"}).timeRange(now)
+	assert.Error(err)
+	_, _, err = (&LogsCmd{From: "1h", To: "2h"}).timeRange(now)
+	assert.Error(err)
+	_, _, err = (&LogsCmd{Since: time.Hour, To: "now", Follow: true}).timeRange(now)
+	assert.Error(err)
+}
+
+func TestCommandsLogsMatcherFiltersTypeAndMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	c := LogsCmd{Type: "access", Grep: `" 5\d\d `}
+	match, err := c.matcher(time.Time{})
+	assert.NoError(err)
+
+	// Test
+	assert.True(match(api.AppLogs{Type: "access", Message: `"GET / HTTP/1.1" 502 12`}))
+	assert.False(match(api.AppLogs{Type: "access", Message: `"GET / HTTP/1.1" 200 12`}))
+	assert.False(match(api.AppLogs{Type: "app", Message: `" 500 `}))
+
+	_, err = (&LogsCmd{Grep: "("}).matcher(time.Time{})
+	assert.Error(err)
+}
+
+func TestCommandsLogsFetchLogRangePaginates(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup: 4000 lines, two per second, more than two pages' worth
+	base := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	var all []api.AppLogs
+	for i := 0; i < 4000; i++ {
+		all = append(all, api.AppLogs{
+			Timestamp:    base.Add(time.Duration(i) * 500 * time.Millisecond).Format(time.RFC3339Nano),
+			InstanceName: "nodejs-a",
+			Type:         "app",
+			Message:      fmt.Sprintf("line %d", i),
+		})
+	}
+	var queries int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		case "/new/authorized/graphql_api/query":
+			queries++
+			var req struct {
+				Variables map[string]interface{} `json:"variables"`
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			assert.NoError(err)
+			assert.NoError(json.Unmarshal(b, &req))
+			start, err := time.Parse(time.RFC3339, req.Variables["startTimestampRfc3339"].(string))
+			assert.NoError(err)
+			page := []api.AppLogs{}
+			for _, l := range all {
+				if !logTime(l).Before(start) && len(page) < int(req.Variables["length"].(float64)) {
+					page = append(page, l)
+				}
+			}
+			b, err = json.Marshal(page)
+			assert.NoError(err)
+			fmt.Fprintf(w, `{"data": {"logs": %s}}`, b)
+		default:
+			assert.FailNowf("unhandled URL", "URL: %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+
+	c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs"}
+	from := base.Add(100 * time.Second)
+	to := base.Add(1800 * time.Second)
+
+	// Invoke
+	logs, err := fetchLogRange(&c, from, to, 0, func(api.AppLogs) bool { return true })
+
+	// Test
+	assert.NoError(err)
+	assert.Len(logs, 3401)
+	assert.Equal("line 200", logs[0].Message)
+	assert.Equal("line 3600", logs[len(logs)-1].Message)
+	assert.Equal(3, queries)
+
+	logs, err = fetchLogRange(&c, from, to, 10, func(api.AppLogs) bool { return true })
+	assert.NoError(err)
+	assert.Len(logs, 10)
+
+	c.Grep = "00$"
+	match, err := c.matcher(time.Time{})
+	assert.NoError(err)
+	logs, err = fetchLogRange(&c, from, to, 10, match)
+	assert.NoError(err)
+	var matched []string
+	for _, l := range logs {
+		if match(l) {
+			matched = append(matched, l.Message)
+		}
+	}
+	assert.Equal([]string{"line 200", "line 300", "line 400", "line 500", "line 600", "line 700", "line 800", "line 900", "line 1000", "line 1100"}, matched)
+}
+
+func TestCommandsLogsSummaryIsWrittenWhenQuiet(t *testing.T) {
+	var testCases = []struct {
+		output string
+		test   func(assert *assert.Assertions, out string)
+	}{
+		{"json", func(assert *assert.Assertions, out string) {
+			var summary AccessLogSummary
+			assert.NoError(json.Unmarshal([]byte(out), &summary))
+			assert.Equal(1, summary.Requests)
+		}},
+		{"table", func(assert *assert.Assertions, out string) {
+			assert.Contains(out, "Requests: 1")
+			assert.Regexp(`\|\s+200\s+\|\s+1\s+\|`, out)
+			assert.Regexp(`\|\s+/\s+\|\s+1\s+\|`, out)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.output, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			now := time.Now().UTC()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/account/1/application/2/environment":
+					fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+				case "/new/authorized/graphql_api/query":
+					page := []api.AppLogs{
+						{Timestamp: now.Add(-time.Minute).Format(time.RFC3339), InstanceName: "nodejs-a", Type: "access", Message: `{"status": 200, "request": "GET / HTTP/1.1", "request_time": 0.1}`},
+						{Timestamp: now.Add(-time.Minute).Format(time.RFC3339), InstanceName: "nodejs-a", Type: "app", Message: "listening"},
+					}
+					b, err := json.Marshal(page)
+					assert.NoError(err)
+					fmt.Fprintf(w, `{"data": {"logs": %s}}`, b)
+				default:
+					assert.FailNowf("unhandled URL", "URL: %s", r.URL.Path)
+				}
+			}))
+			defer ts.Close()
+			ur, err := url.Parse(ts.URL)
+			assert.NoError(err)
+			api.PrefixURI = ur
+			api.MaxAttempts = 1
+
+			var out strings.Builder
+			c := LogsCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", Since: time.Hour, Summary: true, Window: time.Minute, Top: 10}
+			cli := CLI{Quiet: true, Output: tc.output}
+			logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+
+			// Invoke
+			err = c.run(&cli, &logWriters, &out)
+
+			// Test
+			assert.NoError(err)
+			tc.test(assert, out.String())
+		})
+	}
+}
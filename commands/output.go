@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// IsStructuredOutput returns whether the user asked for machine-readable output instead of tables
+func (c *CLI) IsStructuredOutput() bool {
+	return c.Template != "" || (c.Output != "" && c.Output != outputTable)
+}
+
+// WriteStructured writes v to out as JSON, YAML, or through the user's Go template,
+// depending on the --output and --template flags.
+//
+// It returns false without writing anything when the user asked for tables, so
+// callers can fall back to rendering them.
+func WriteStructured(cli *CLI, out io.Writer, v interface{}) (ok bool, err error) {
+	if !cli.IsStructuredOutput() {
+		return false, nil
+	}
+
+	if cli.Template != "" {
+		return true, writeTemplate(out, cli.Template, v)
+	}
+
+	switch cli.Output {
+	case outputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return true, enc.Encode(v)
+	case outputYAML:
+		return true, writeYAML(out, v)
+	default:
+		return true, fmt.Errorf("unknown output format: %s", cli.Output)
+	}
+}
+
+// writeTemplate renders v through the Go template text, ensuring the output ends in a newline
+func writeTemplate(out io.Writer, text string, v interface{}) error {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+	tmpl, err := template.New("output").Funcs(funcs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("unable to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		return fmt.Errorf("unable to execute template: %w", err)
+	}
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err = buf.WriteTo(out)
+	return err
+}
+
+// writeYAML writes v as YAML, using the same field names and ordering as the JSON output.
+//
+// The api types only carry json struct tags, so v is round-tripped through JSON, which
+// is itself valid YAML, and the resulting node tree is re-emitted in block style.
+func writeYAML(out io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return err
+	}
+	resetYAMLStyle(&node)
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func resetYAMLStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		resetYAMLStyle(c)
+	}
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsWriteStructuredFallsBackToTables(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	cli := CLI{Output: "table"}
+	var out bytes.Buffer
+
+	// Invoke
+	ok, err := WriteStructured(&cli, &out, []api.Stack{{Name: "nodejs-basic"}})
+
+	// Test
+	assert.NoError(err)
+	assert.False(ok)
+	assert.Zero(out.Len())
+}
+
+func TestCommandsWriteStructuredFormats(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	accounts := []api.Account{
+		{ID: 1, AccountName: "Example", Applications: []api.App{{ID: 2, ApplicationName: "123"}}},
+	}
+	var testCases = []struct {
+		cli      CLI
+		expected string
+	}{
+		{CLI{Output: "json"}, "[\n  {\n    \"id\": 1,\n"},
+		{CLI{Output: "yaml"}, "- id: 1\n  href: \"\"\n  account_name: Example\n"},
+		{CLI{Output: "yaml"}, "application_name: \"123\"\n"},
+		{CLI{Output: "table", Template: "{{range .}}{{.ID}} {{.AccountName}}{{end}}"}, "1 Example\n"},
+		{CLI{Output: "table", Template: "{{json (index . 0).Applications}}"}, `[{"id":2,"href":"","application_name":"123","environments":null}]`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cli.Output+tc.cli.Template, func(t *testing.T) {
+			var out bytes.Buffer
+
+			// Invoke
+			ok, err := WriteStructured(&tc.cli, &out, accounts)
+
+			// Test
+			assert.NoError(err)
+			assert.True(ok)
+			assert.Contains(out.String(), tc.expected)
+		})
+	}
+}
+
+func TestCommandsWriteStructuredErrorsOnBadTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	cli := CLI{Template: "{{.Nope"}
+	var out bytes.Buffer
+
+	// Invoke
+	ok, err := WriteStructured(&cli, &out, api.User{})
+
+	// Test
+	assert.True(ok)
+	assert.Error(err)
+}
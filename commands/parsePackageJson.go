@@ -13,16 +13,20 @@ import (
 )
 
 type PackageJSON struct {
-	Name         string            `json:"name"`
-	Version      string            `json:"version"`
-	Dependencies map[string]string `json:"dependencies"`
-	Scripts      map[string]string `json:"scripts"`
-	Section      struct {
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	Main            string            `json:"main"`
+	Engines         map[string]string `json:"engines"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+	Scripts         map[string]string `json:"scripts"`
+	Section         struct {
 		AccountID   string `json:"accountId"`
 		AppID       string `json:"appId"`
 		Environment string `json:"environment"`
 		ModuleName  string `json:"module-name"`
 		StartScript string `json:"start-script"`
+		Build       string `json:"build"`
 	} `json:"section"`
 	X map[string]interface{} `json:"-"` // Rest of the fields should go here.
 }
@@ -43,11 +47,14 @@ type MinimalPackageJSON struct {
 	X map[string]interface{} `json:"-"` // Rest of the fields should go here.
 }
 type SectionConfigJSON struct {
-	Proxychain []struct {
-		Name  string `json:"name"`
-		Image string `json:"image"`
-	} `json:"proxychain"`
-	X map[string]interface{} `json:"-"` // Rest of the fields should go here.
+	Proxychain []ProxychainModule      `json:"proxychain"`
+	X          map[string]interface{} `json:"-"` // Rest of the fields should go here.
+}
+
+// ProxychainModule is a module in an environment's proxychain
+type ProxychainModule struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
 }
 
 // Try to fit the contents of the package.json into one of the three structs defined above, as JSON isn't strictly typed.
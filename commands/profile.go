@@ -0,0 +1,247 @@
+package commands
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/config"
+)
+
+// ProfileCmd manages named profiles for working against multiple Section endpoints and accounts
+type ProfileCmd struct {
+	List   ProfileListCmd   `cmd help:"List profiles." default:"1"`
+	Use    ProfileUseCmd    `cmd help:"Set the profile used when --profile is not given."`
+	Add    ProfileAddCmd    `cmd help:"Add or update a profile."`
+	Remove ProfileRemoveCmd `cmd help:"Remove a profile."`
+}
+
+// ProfileSummary is a profile as shown by 'profile list'
+type ProfileSummary struct {
+	Name            string `json:"name"`
+	Current         bool   `json:"current"`
+	APIPrefix       string `json:"apiPrefix,omitempty"`
+	APITimeout      string `json:"apiTimeout,omitempty"`
+	AccountID       int    `json:"accountId,omitempty"`
+	AppID           int    `json:"appId,omitempty"`
+	Environment     string `json:"environment,omitempty"`
+	KeyringKey      string `json:"keyringKey,omitempty"`
+	CredentialStore string `json:"credentialStore,omitempty"`
+}
+
+// ProfileListCmd handles listing profiles
+type ProfileListCmd struct{}
+
+// Run executes the command
+func (c *ProfileListCmd) Run(cli *CLI) (err error) {
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	summaries := []ProfileSummary{}
+	for _, name := range cfg.ProfileNames() {
+		p := cfg.Profiles[name]
+		s := ProfileSummary{
+			Name:            name,
+			Current:         name == cfg.CurrentProfile,
+			APIPrefix:       p.APIPrefix,
+			AccountID:       p.AccountID,
+			AppID:           p.AppID,
+			Environment:     p.Environment,
+			KeyringKey:      p.KeyringKey,
+			CredentialStore: p.CredentialStore,
+		}
+		if p.APITimeout > 0 {
+			s.APITimeout = p.APITimeout.String()
+		}
+		summaries = append(summaries, s)
+	}
+
+	if ok, err := WriteStructured(cli, os.Stdout, summaries); ok {
+		return err
+	}
+
+	if len(summaries) == 0 {
+		log.Info().Msgf("No profiles configured in %s. Add one with 'sectionctl profile add'.", path)
+		return nil
+	}
+
+	table := NewTable(cli, os.Stdout)
+	table.SetHeader([]string{"", "Name", "API Prefix", "Account ID", "App ID", "Environment"})
+	for _, s := range summaries {
+		var current string
+		if s.Current {
+			current = "*"
+		}
+		r := []string{current, s.Name, s.APIPrefix, optionalID(s.AccountID), optionalID(s.AppID), s.Environment}
+		table.Append(r)
+	}
+	table.Render()
+	return nil
+}
+
+// ProfileUseCmd handles switching the current profile
+type ProfileUseCmd struct {
+	Name string `arg help:"Name of the profile to use."`
+}
+
+// Run executes the command
+func (c *ProfileUseCmd) Run() (err error) {
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.UseProfile(c.Name); err != nil {
+		return err
+	}
+	if err := cfg.Save(path); err != nil {
+		return err
+	}
+	log.Info().Msgf("Now using profile %s", c.Name)
+	return nil
+}
+
+// ProfileAddCmd handles adding or updating a profile
+type ProfileAddCmd struct {
+	Name               string        `arg help:"Name of the profile."`
+	APIPrefix          *url.URL      `name:"api-prefix" help:"Section API prefix, e.g. https://aperture.section.io"`
+	APITimeout         time.Duration `name:"api-timeout" help:"Request timeout for the Section API."`
+	DefaultAccountID   int           `help:"Account ID used when --account-id is not given."`
+	DefaultAppID       int           `help:"App ID used when --app-id is not given."`
+	DefaultEnvironment string        `help:"Environment used when --environment is not given."`
+	KeyringKey         string        `help:"Key the API token is stored under. Defaults to the API prefix's host, so give profiles for different accounts on the same endpoint their own key."`
+	CredentialStore    string        `enum:"auto,keyring,file,env," default:"" help:"Where to store the API token for this profile: auto, keyring, file, or env."`
+	Use                bool          `help:"Also make this the current profile."`
+}
+
+// Run executes the command
+func (c *ProfileAddCmd) Run() (err error) {
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	p := config.Profile{
+		APITimeout:      c.APITimeout,
+		AccountID:       c.DefaultAccountID,
+		AppID:           c.DefaultAppID,
+		Environment:     c.DefaultEnvironment,
+		KeyringKey:      c.KeyringKey,
+		CredentialStore: c.CredentialStore,
+	}
+	if c.APIPrefix != nil {
+		p.APIPrefix = c.APIPrefix.String()
+	}
+	cfg.SetProfile(c.Name, p)
+	if c.Use || len(cfg.Profiles) == 1 {
+		cfg.CurrentProfile = c.Name
+	}
+	if err := cfg.Save(path); err != nil {
+		return err
+	}
+	log.Info().Msgf("Saved profile %s to %s", c.Name, path)
+	return nil
+}
+
+// ProfileRemoveCmd handles removing a profile
+type ProfileRemoveCmd struct {
+	Name string `arg help:"Name of the profile to remove."`
+}
+
+// Run executes the command
+func (c *ProfileRemoveCmd) Run() (err error) {
+	cfg, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.RemoveProfile(c.Name); err != nil {
+		return err
+	}
+	if err := cfg.Save(path); err != nil {
+		return err
+	}
+	log.Info().Msgf("Removed profile %s", c.Name)
+	return nil
+}
+
+// ActiveProfile returns the name of the profile selected by --profile, SECTION_PROFILE,
+// or the config's current profile, and the profile itself.
+//
+// An empty name means no profile is in use.
+func ActiveProfile(selected string, cfg config.Config) (name string, p config.Profile, err error) {
+	name = selected
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		return "", p, nil
+	}
+	p, err = cfg.Profile(name)
+	return name, p, err
+}
+
+// ProfileResolver returns a Resolver that fills in flags from the active profile.
+//
+// Values given on the command line, through environment variables, or in package.json
+// take precedence over the profile. Unknown profiles are ignored here and reported
+// when the CLI is bootstrapped.
+func ProfileResolver(cfg config.Config) kong.Resolver {
+	var f kong.ResolverFunc = func(context *kong.Context, parent *kong.Path, flag *kong.Flag) (interface{}, error) {
+		if flag.Tag.Env != "" && os.Getenv(flag.Tag.Env) != "" {
+			return nil, nil
+		}
+		_, p, err := ActiveProfile(selectedProfile(context), cfg)
+		if err != nil {
+			return nil, nil
+		}
+		switch {
+		case flag.Name == "section-api-prefix" && p.APIPrefix != "":
+			return p.APIPrefix, nil
+		case flag.Name == "section-api-timeout" && p.APITimeout > 0:
+			return p.APITimeout.String(), nil
+		case flag.Name == "credential-key" && p.KeyringKey != "":
+			return p.KeyringKey, nil
+		case flag.Name == "credential-store" && p.CredentialStore != "":
+			return p.CredentialStore, nil
+		case flag.Name == "account-id" && p.AccountID > 0:
+			return strconv.Itoa(p.AccountID), nil
+		case flag.Name == "app-id" && p.AppID > 0:
+			return strconv.Itoa(p.AppID), nil
+		case flag.Name == "environment" && p.Environment != "":
+			return p.Environment, nil
+		}
+		return nil, nil
+	}
+	return f
+}
+
+// selectedProfile returns the value of the --profile flag, from the command line or SECTION_PROFILE
+func selectedProfile(context *kong.Context) string {
+	for _, f := range context.Flags() {
+		if f.Name == "profile" {
+			if s, ok := context.FlagValue(f).(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func loadConfig() (cfg config.Config, path string, err error) {
+	path, err = config.Path()
+	if err != nil {
+		return cfg, path, err
+	}
+	cfg, err = config.Load(path)
+	return cfg, path, err
+}
+
+func optionalID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
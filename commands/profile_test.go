@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/section/sectionctl/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandsProfileResolverFillsFlagsFromProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var cfg config.Config
+	cfg.SetProfile("staging", config.Profile{
+		APIPrefix:   "https://staging.example.com",
+		APITimeout:  45 * time.Second,
+		AccountID:   1,
+		AppID:       2,
+		Environment: "Development",
+		KeyringKey:  "staging-key",
+	})
+	cfg.SetProfile("prod", config.Profile{AccountID: 3})
+	cfg.CurrentProfile = "prod"
+
+	var testCases = []struct {
+		args      []string
+		prefix    string
+		accountID int
+		appID     int
+	}{
+		{[]string{"--profile", "staging", "ps"}, "https://staging.example.com", 1, 2},
+		{[]string{"--profile", "staging", "ps", "-a", "9"}, "https://staging.example.com", 9, 2},
+		{[]string{"ps", "-i", "4"}, "https://aperture.section.io", 3, 4},
+	}
+
+	for _, tc := range testCases {
+		var cli CLI
+		parser, err := kong.New(&cli, kong.Exit(func(int) { t.Fatal("exited") }), kong.Resolvers(ProfileResolver(cfg)))
+		assert.NoError(err)
+
+		// Invoke
+		_, err = parser.Parse(tc.args)
+
+		// Test
+		assert.NoError(err)
+		assert.Equal(tc.prefix, cli.SectionAPIPrefix.String())
+		assert.Equal(tc.accountID, cli.Ps.AccountID)
+		assert.Equal(tc.appID, cli.Ps.AppID)
+	}
+}
+
+func TestCommandsProfileResolverPrefersEnvironmentVariables(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var cfg config.Config
+	cfg.SetProfile("staging", config.Profile{APIPrefix: "https://staging.example.com", KeyringKey: "staging-key"})
+	os.Setenv("SECTION_API_PREFIX", "https://env.example.com")
+	defer os.Unsetenv("SECTION_API_PREFIX")
+
+	var cli CLI
+	parser, err := kong.New(&cli, kong.Exit(func(int) { t.Fatal("exited") }), kong.Resolvers(ProfileResolver(cfg)))
+	assert.NoError(err)
+
+	// Invoke
+	_, err = parser.Parse([]string{"--profile", "staging", "version"})
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("https://env.example.com", cli.SectionAPIPrefix.String())
+	assert.Equal("staging-key", cli.TokenKey())
+}
+
+func TestCommandsProfileAddUseRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := filepath.Join(t.TempDir(), "config")
+	os.Setenv(config.PathEnv, path)
+	defer os.Unsetenv(config.PathEnv)
+
+	// Invoke
+	assert.NoError((&ProfileAddCmd{Name: "staging", DefaultAccountID: 1}).Run())
+	assert.NoError((&ProfileAddCmd{Name: "prod", DefaultAccountID: 2}).Run())
+	cfg, err := config.Load(path)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("staging", cfg.CurrentProfile, "first profile added becomes current")
+	assert.Equal(2, cfg.Profiles["prod"].AccountID)
+
+	assert.NoError((&ProfileUseCmd{Name: "prod"}).Run())
+	assert.Error((&ProfileUseCmd{Name: "missing"}).Run())
+	assert.NoError((&ProfileRemoveCmd{Name: "prod"}).Run())
+	cfg, err = config.Load(path)
+	assert.NoError(err)
+	assert.Empty(cfg.CurrentProfile)
+	assert.Equal([]string{"staging"}, cfg.ProfileNames())
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBarWidth is the number of characters used to draw the bar itself
+const progressBarWidth = 30
+
+// ProgressBar shows the progress of a transfer of a known number of bytes.
+//
+// On a console it redraws a bar in place with percentage, throughput and ETA.
+// In plain mode, for CI logs, it prints a line at every 10% instead.
+type ProgressBar struct {
+	txt   string
+	out   io.Writer
+	total int64
+	plain bool
+
+	mu          sync.Mutex
+	start       time.Time
+	current     int64
+	lastRender  time.Time
+	lastPercent int
+	done        bool
+}
+
+// NewProgressBar returns a progress bar for a transfer of total bytes.
+//
+// Progress is drawn on logWriters.ConsoleOnly, falling back to plain periodic
+// percentages when minimal logging was requested with --quiet or SECTION_CI.
+func NewProgressBar(txt string, total int64, cli *CLI, logWriters *LogWriters) *ProgressBar {
+	return &ProgressBar{
+		txt:         txt,
+		out:         logWriters.ConsoleOnly,
+		total:       total,
+		plain:       cli != nil && bool(cli.Quiet),
+		lastPercent: -1,
+	}
+}
+
+// Reader wraps r so that bytes read through it are counted as progress.
+func (p *ProgressBar) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+// Add records n more bytes as transferred.
+func (p *ProgressBar) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.start.IsZero() {
+		p.start = now
+	}
+	p.current += n
+	if p.current > p.total {
+		p.current = p.total
+	}
+	if p.plain {
+		pct := p.percent()
+		if pct/10 > p.lastPercent/10 {
+			p.lastPercent = pct
+			fmt.Fprintf(p.out, "%s: %d%% (%s of %s)\n", p.txt, pct, formatBytes(p.current), formatBytes(p.total))
+		}
+		return
+	}
+	if now.Sub(p.lastRender) < 100*time.Millisecond && p.current < p.total {
+		return
+	}
+	p.lastRender = now
+	p.render(now)
+}
+
+// Set records the transfer as having reached n bytes, as when it is resumed, or part of it is sent again.
+func (p *ProgressBar) Set(n int64) {
+	p.mu.Lock()
+	p.current = 0
+	p.mu.Unlock()
+	p.Add(n)
+}
+
+// Finish draws the final state of the bar and moves to a new line.
+func (p *ProgressBar) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	if p.plain {
+		return
+	}
+	p.render(time.Now())
+	fmt.Fprintln(p.out)
+}
+
+func (p *ProgressBar) percent() int {
+	if p.total <= 0 {
+		return 100
+	}
+	return int(p.current * 100 / p.total)
+}
+
+func (p *ProgressBar) render(now time.Time) {
+	pct := p.percent()
+	filled := pct * progressBarWidth / 100
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	elapsed := now.Sub(p.start).Seconds()
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.current) / elapsed
+	}
+	eta := "--"
+	if rate > 0 && p.current < p.total {
+		eta = time.Duration(float64(p.total-p.current) / rate * float64(time.Second)).Round(time.Second).String()
+	} else if p.current >= p.total {
+		eta = "0s"
+	}
+
+	fmt.Fprintf(p.out, "\r%s [%s] %3d%% %s/%s %s/s ETA %s   ", p.txt, bar, pct, formatBytes(p.current), formatBytes(p.total), formatBytes(int64(rate)), eta)
+}
+
+type progressReader struct {
+	r io.Reader
+	p *ProgressBar
+}
+
+func (pr *progressReader) Read(b []byte) (n int, err error) {
+	n, err = pr.r.Read(b)
+	if n > 0 {
+		pr.p.Add(int64(n))
+	}
+	return n, err
+}
+
+// formatBytes returns a human readable byte count, like 12.3MB
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
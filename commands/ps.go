@@ -11,11 +11,20 @@ import (
 
 // PsCmd checks an application's status on Section's delivery platform
 type PsCmd struct {
-	AccountID int           `short:"a" help:"ID of account to query"`
-	AppID     int           `short:"i" help:"ID of app to query"`
-	AppPath   string        `default:"nodejs" help:"Path of NodeJS application in environment repository."`
-	Watch     bool          `short:"w" help:"Run repeatedly, output status"`
-	Interval  time.Duration `short:"t" default:"10s" help:"Interval to poll if watching"`
+	AccountID       int           `short:"a" help:"ID of account to query"`
+	AppID           int           `short:"i" help:"ID of app to query"`
+	Environment     string        `short:"e" default:"Production" help:"Environment to query. (name of git branch ie: Production, staging, development)"`
+	AllEnvironments bool          `help:"Show the status of every environment of each app, side by side."`
+	AppPath         string        `default:"nodejs" help:"Path of NodeJS application in environment repository."`
+	Watch           bool          `short:"w" help:"Run repeatedly, output status"`
+	Interval        time.Duration `short:"t" default:"10s" help:"Interval to poll if watching"`
+}
+
+// psTarget is an app environment to get the status of
+type psTarget struct {
+	AccountID   int
+	AppID       int
+	Environment string
 }
 
 func getStatus(as api.AppStatus) string {
@@ -48,7 +57,7 @@ func (c *PsCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 		aids = append(aids, c.AccountID)
 	}
 
-	var targets [][]int
+	var apps [][]int
 	for _, id := range aids {
 		if c.AppID == 0 {
 			s := NewSpinner("Looking up applications", logWriters)
@@ -59,12 +68,31 @@ func (c *PsCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 				return fmt.Errorf("unable to look up applications: %w", err)
 			}
 			for _, a := range as {
-				targets = append(targets, []int{id, a.ID})
+				apps = append(apps, []int{id, a.ID})
 			}
 
 			s.Stop()
 		} else {
-			targets = append(targets, []int{id, c.AppID})
+			apps = append(apps, []int{id, c.AppID})
+		}
+	}
+
+	var targets []psTarget
+	for _, a := range apps {
+		if !c.AllEnvironments {
+			targets = append(targets, psTarget{AccountID: a[0], AppID: a[1], Environment: c.Environment})
+			continue
+		}
+
+		s := NewSpinner("Looking up environments", logWriters)
+		s.Start()
+		envs, err := api.ApplicationEnvironments(a[0], a[1])
+		s.Stop()
+		if err != nil {
+			return fmt.Errorf("unable to look up environments: %w", err)
+		}
+		for _, e := range envs {
+			targets = append(targets, psTarget{AccountID: a[0], AppID: a[1], Environment: e.EnvironmentName})
 		}
 	}
 
@@ -84,24 +112,41 @@ func (c *PsCmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 	return nil
 }
 
-func pollAndOutput(cli *CLI, targets [][]int, appPath string, logWriters *LogWriters) error {
+// AppInstances represents the status of each instance of an app
+type AppInstances struct {
+	AccountID   int             `json:"account_id"`
+	AppID       int             `json:"app_id"`
+	Environment string          `json:"environment"`
+	Instances   []api.AppStatus `json:"instances"`
+}
+
+func pollAndOutput(cli *CLI, targets []psTarget, appPath string, logWriters *LogWriters) error {
 	s := NewSpinner("Getting status of apps",logWriters)
 	s.Start()
 
-	table := NewTable(cli, os.Stdout)
-	table.SetHeader([]string{"Account ID", "App ID", "App instance name", "App Status", "App Payload ID"})
-
+	var statuses []AppInstances
 	for _, t := range targets {
-		appStatus, err := api.ApplicationStatus(t[0], t[1], appPath)
+		appStatus, err := api.ApplicationStatus(t.AccountID, t.AppID, t.Environment, appPath)
 		s.Stop()
 		if err != nil {
 			return err
 		}
+		statuses = append(statuses, AppInstances{AccountID: t.AccountID, AppID: t.AppID, Environment: t.Environment, Instances: appStatus})
+	}
+
+	if ok, err := WriteStructured(cli, os.Stdout, statuses); ok {
+		return err
+	}
+
+	table := NewTable(cli, os.Stdout)
+	table.SetHeader([]string{"Account ID", "App ID", "Environment", "App instance name", "App Status", "App Payload ID"})
 
-		for _, a := range appStatus {
+	for _, st := range statuses {
+		for _, a := range st.Instances {
 			r := []string{
-				strconv.Itoa(t[0]),
-				strconv.Itoa(t[1]),
+				strconv.Itoa(st.AccountID),
+				strconv.Itoa(st.AppID),
+				st.Environment,
 				a.InstanceName,
 				getStatus(a),
 				a.PayloadID,
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/api"
+)
+
+// rolloutLogLines is the number of log lines shown when a rollout fails
+const rolloutLogLines = 50
+
+// maxStatusErrors is the number of times in a row the app's status can fail to be fetched before giving up
+const maxStatusErrors = 5
+
+// failedStates are the states an instance doesn't recover from without another deploy
+var failedStates = map[string]bool{"Failed": true, "Error": true, "Crashed": true, "CrashLoopBackOff": true}
+
+// rolledOut returns whether every instance is in service and running the latest payload, payloadID
+func rolledOut(statuses []api.AppStatus, payloadID string) bool {
+	if len(statuses) == 0 {
+		return false
+	}
+	for _, s := range statuses {
+		if s.PayloadID != payloadID || !s.IsLatest || !s.InService || s.State != "Running" {
+			return false
+		}
+	}
+	return true
+}
+
+// rolloutFailure returns why the rollout of payloadID has failed, or an empty string if it hasn't.
+//
+// An instance running payloadID fails the rollout if it is in a failed state, or has been out of
+// service for longer than grace, as recorded in outSince, which is updated with statuses.
+func rolloutFailure(statuses []api.AppStatus, payloadID string, outSince map[string]time.Time, grace time.Duration, now time.Time) string {
+	for _, s := range statuses {
+		if s.PayloadID != payloadID {
+			continue
+		}
+		if failedStates[s.State] {
+			return fmt.Sprintf("instance %s is %s", s.InstanceName, s.State)
+		}
+		if s.State == "Deploying" || (s.InService && s.State == "Running") {
+			delete(outSince, s.InstanceName)
+			continue
+		}
+		since, ok := outSince[s.InstanceName]
+		if !ok {
+			outSince[s.InstanceName] = now
+			continue
+		}
+		if now.Sub(since) > grace {
+			return fmt.Sprintf("instance %s has been %s for %s", s.InstanceName, getStatus(s), now.Sub(since).Round(time.Second))
+		}
+	}
+	return ""
+}
+
+// waitForRollout polls the status of an app environment until every instance runs payloadID,
+// reporting each instance's state as it changes.
+//
+// If an instance running payloadID fails, or the rollout doesn't finish within c.WaitTimeout, the
+// most recent app logs are shown and an error is returned.
+func waitForRollout(c *DeployCmd, payloadID string) error {
+	log.Info().Msg(fmt.Sprintf("Waiting up to %s for payload %s to roll out...", c.WaitTimeout, payloadID))
+	deadline := time.Now().Add(c.WaitTimeout)
+	interval := c.WaitInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	seen := make(map[string]string)
+	outSince := make(map[string]time.Time)
+	var statusErrors int
+	for {
+		statuses, err := api.ApplicationStatus(c.AccountID, c.AppID, c.Environment, c.AppPath)
+		if err != nil {
+			statusErrors++
+			if statusErrors >= maxStatusErrors {
+				return fmt.Errorf("unable to get app status %d times in a row, so unable to tell if payload %s rolled out: %w", statusErrors, payloadID, err)
+			}
+			log.Warn().Err(err).Msg("Unable to get app status, will try again")
+		} else {
+			statusErrors = 0
+			for _, s := range statuses {
+				state := fmt.Sprintf("%s %t %s", s.State, s.InService, s.PayloadID)
+				if seen[s.InstanceName] == state {
+					continue
+				}
+				seen[s.InstanceName] = state
+				payload := "previous payload"
+				if s.PayloadID == payloadID {
+					payload = "new payload"
+				}
+				log.Info().Str("Instance", s.InstanceName).Str("Status", getStatus(s)).Str("State", s.State).Str("Payload", payload).Msg("")
+			}
+			if rolledOut(statuses, payloadID) {
+				log.Info().Msg(fmt.Sprintf("All %d instances are running payload %s", len(statuses), payloadID))
+				return nil
+			}
+			if reason := rolloutFailure(statuses, payloadID, outSince, c.WaitGrace, time.Now()); reason != "" {
+				printLogTail(c)
+				return fmt.Errorf("payload %s failed to roll out: %s", payloadID, reason)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			printLogTail(c)
+			return fmt.Errorf("timed out after %s waiting for payload %s to roll out", c.WaitTimeout, payloadID)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// printLogTail shows the most recent logs of an app environment, to help diagnose failed rollouts
+func printLogTail(c *DeployCmd) {
+	logs, err := api.ApplicationLogs(c.AccountID, c.AppID, c.Environment, c.AppPath, "", rolloutLogLines, "")
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to fetch app logs")
+		return
+	}
+	log.Error().Msg(fmt.Sprintf("Last %d lines of app logs:", len(logs)))
+	for _, a := range logs {
+		log.Error().Msg(fmt.Sprintf("%s[%s]\t%s", a.InstanceName, a.Type, strings.TrimSpace(a.Message)))
+	}
+}
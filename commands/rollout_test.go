@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/section/sectionctl/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func helperRolloutServer(t *testing.T, statuses []string, logsCalled *bool) *httptest.Server {
+	var polls int
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/account/1/application/2/environment":
+			fmt.Fprint(w, `[{"id": 10, "environment_name": "Production"}]`)
+		case "/new/authorized/graphql_api/query":
+			b, err := ioutil.ReadAll(r.Body)
+			assert.NoError(t, err)
+			if strings.Contains(string(b), "deploymentStatus") {
+				i := polls
+				if i >= len(statuses) {
+					i = len(statuses) - 1
+				}
+				polls++
+				if statuses[i] == "" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				fmt.Fprintf(w, `{"data": {"deploymentStatus": %s}}`, statuses[i])
+				return
+			}
+			*logsCalled = true
+			fmt.Fprint(w, `{"data": {"logs": [{"instanceName": "nodejs-a", "type": "app", "message": "boom"}]}}`)
+		default:
+			assert.FailNowf(t, "unhandled URL", "URL: %s", r.URL.Path)
+		}
+	}))
+}
+
+func TestCommandsDeployWaitsForRollout(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	statuses := []string{
+		`[{"inService": true, "state": "Running", "instanceName": "nodejs-a", "payloadID": "old"}]`,
+		`[{"inService": false, "state": "Deploying", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+		`[{"inService": true, "state": "Running", "instanceName": "nodejs-a", "payloadID": "new", "isLatest": true}, {"inService": true, "state": "Running", "instanceName": "nodejs-b", "payloadID": "new", "isLatest": false}]`,
+		`[{"inService": true, "state": "Running", "instanceName": "nodejs-a", "payloadID": "new", "isLatest": true}, {"inService": true, "state": "Running", "instanceName": "nodejs-b", "payloadID": "new", "isLatest": true}]`,
+	}
+	var logsCalled bool
+	ts := helperRolloutServer(t, statuses, &logsCalled)
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+
+	c := DeployCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", WaitTimeout: 5 * time.Second, WaitInterval: time.Millisecond}
+
+	// Invoke
+	err = waitForRollout(&c, "new")
+
+	// Test
+	assert.NoError(err)
+	assert.False(logsCalled)
+}
+
+func TestCommandsDeployWaitTimesOutAndShowsLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	statuses := []string{
+		`[{"inService": false, "state": "Deploying", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+	}
+	var logsCalled bool
+	ts := helperRolloutServer(t, statuses, &logsCalled)
+	defer ts.Close()
+	ur, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	api.PrefixURI = ur
+
+	c := DeployCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", WaitTimeout: 20 * time.Millisecond, WaitInterval: time.Millisecond}
+
+	// Invoke
+	err = waitForRollout(&c, "new")
+
+	// Test
+	assert.Error(err)
+	assert.Regexp("timed out", err)
+	assert.True(logsCalled)
+}
+
+func TestCommandsDeployWaitFailsRollout(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		statuses []string
+		err      string
+		logs     bool
+	}{
+		{"failed state", []string{
+			`[{"inService": false, "state": "Deploying", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+			`[{"inService": false, "state": "CrashLoopBackOff", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+		}, "instance nodejs-a is CrashLoopBackOff", true},
+		{"out of service", []string{
+			`[{"inService": true, "state": "Running", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+			`[{"inService": false, "state": "Running", "instanceName": "nodejs-a", "payloadID": "new"}]`,
+		}, "instance nodejs-a has been Not Running", true},
+		{"status errors", []string{""}, "unable to get app status 5 times in a row", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			var logsCalled bool
+			ts := helperRolloutServer(t, tc.statuses, &logsCalled)
+			defer ts.Close()
+			ur, err := url.Parse(ts.URL)
+			assert.NoError(err)
+			api.PrefixURI = ur
+			api.MaxAttempts = 1
+
+			c := DeployCmd{AccountID: 1, AppID: 2, Environment: "Production", AppPath: "nodejs", WaitTimeout: time.Minute, WaitInterval: time.Millisecond, WaitGrace: 10 * time.Millisecond}
+
+			// Invoke
+			err = waitForRollout(&c, "new")
+
+			// Test
+			if assert.Error(err) {
+				assert.Contains(err.Error(), tc.err)
+			}
+			assert.Equal(tc.logs, logsCalled)
+		})
+	}
+}
+
+func TestCommandsDeployRolledOut(t *testing.T) {
+	assert := assert.New(t)
+
+	running := api.AppStatus{InService: true, State: "Running", PayloadID: "new", IsLatest: true}
+	notLatest := api.AppStatus{InService: true, State: "Running", PayloadID: "new"}
+	old := api.AppStatus{InService: true, State: "Running", PayloadID: "old"}
+	deploying := api.AppStatus{InService: false, State: "Deploying", PayloadID: "new", IsLatest: true}
+
+	assert.False(rolledOut(nil, "new"))
+	assert.True(rolledOut([]api.AppStatus{running, running}, "new"))
+	assert.False(rolledOut([]api.AppStatus{running, old}, "new"))
+	assert.False(rolledOut([]api.AppStatus{running, deploying}, "new"))
+	assert.False(rolledOut([]api.AppStatus{running, notLatest}, "new"))
+}
@@ -0,0 +1,329 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/section/sectionctl/api"
+)
+
+const (
+	uploadModeAuto    = "auto"
+	uploadModeSingle  = "single"
+	uploadModeChunked = "chunked"
+)
+
+var (
+	// chunkRetryDelay is the delay before the first retry of a chunk, doubling for each later retry
+	chunkRetryDelay = 1 * time.Second
+	// chunkMaxRetryDelay caps the delay between retries of a chunk
+	chunkMaxRetryDelay = 30 * time.Second
+)
+
+// errChunkedUploadNotStarted is returned when the upload service doesn't start a chunked upload,
+// so the tarball can be sent in a single request instead.
+var errChunkedUploadNotStarted = errors.New("the upload service did not start a chunked upload")
+
+// errUploadSessionGone is returned when the upload service no longer knows an upload session
+var errUploadSessionGone = errors.New("upload session not found")
+
+// errChunkRejected is returned when the upload service refuses a chunk, so sending it again won't help
+var errChunkRejected = errors.New("chunk rejected")
+
+// uploadSession is the state of a chunked upload.
+//
+// It is saved next to the tarball, so an interrupted upload of the same tarball can be resumed.
+type uploadSession struct {
+	UploadID  string `json:"uploadID"`
+	ServerURL string `json:"serverURL"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunkSize"`
+	Offset    int64  `json:"offset"`
+}
+
+// chunkedUploader uploads a tarball in chunks, retrying each chunk and resuming where the
+// upload service says it got to.
+//
+// The protocol, relative to --server-url, is:
+//
+//	POST /sessions               starts an upload, returning its uploadID and chunkSize
+//	GET  /sessions/{id}          returns the offset the service has received up to
+//	PUT  /sessions/{id}          sends the chunk in Content-Range, returning the new offset
+//	POST /sessions/{id}/complete finishes the upload, returning its payloadID
+type chunkedUploader struct {
+	c        *DeployCmd
+	client   *http.Client
+	path     string
+	size     int64
+	digest   string
+	progress *ProgressBar
+
+	session uploadSession
+}
+
+func newChunkedUploader(c *DeployCmd, path string, size int64, digest string, progress *ProgressBar) *chunkedUploader {
+	return &chunkedUploader{
+		c:        c,
+		client:   &http.Client{Timeout: c.Timeout},
+		path:     path,
+		size:     size,
+		digest:   digest,
+		progress: progress,
+	}
+}
+
+// statePath is where the upload's session is saved
+func (u *chunkedUploader) statePath() string {
+	return u.path + ".upload.json"
+}
+
+// Upload sends the tarball, resuming a saved session for it if there is one
+func (u *chunkedUploader) Upload() (response UploadResponse, err error) {
+	f, err := os.Open(u.path)
+	if err != nil {
+		return response, err
+	}
+	defer f.Close()
+
+	if !u.resume() {
+		if err := u.start(); err != nil {
+			return response, err
+		}
+	}
+
+	for u.session.Offset < u.size {
+		if err := u.sendChunk(f); err != nil {
+			return response, err
+		}
+	}
+
+	response, err = u.complete()
+	if err != nil {
+		return response, err
+	}
+	os.Remove(u.statePath())
+	return response, nil
+}
+
+// resume picks up a saved session for the same tarball, returning false if there isn't one to continue
+func (u *chunkedUploader) resume() bool {
+	b, err := ioutil.ReadFile(u.statePath())
+	if err != nil {
+		return false
+	}
+	var s uploadSession
+	if err := json.Unmarshal(b, &s); err != nil {
+		return false
+	}
+	if s.SHA256 != u.digest || s.Size != u.size || s.ServerURL != u.c.ServerURL.String() || s.ChunkSize <= 0 {
+		return false
+	}
+	u.session = s
+	offset, err := u.offset()
+	if err != nil {
+		log.Debug().Err(err).Str("Upload ID", s.UploadID).Msg("Unable to resume upload, starting again")
+		return false
+	}
+	u.session.Offset = offset
+	u.progress.Set(offset)
+	log.Info().Str("Upload ID", s.UploadID).Msg(fmt.Sprintf("Resuming upload from %s", formatBytes(offset)))
+	return true
+}
+
+// start creates an upload session
+func (u *chunkedUploader) start() error {
+	body, err := json.Marshal(map[string]interface{}{
+		"account_id": u.c.AccountID,
+		"app_id":     u.c.AppID,
+		"size":       u.size,
+		"sha256":     u.digest,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := u.do(http.MethodPost, "/sessions", bytes.NewReader(body), nil)
+	if err != nil {
+		return fmt.Errorf("unable to start upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %v", errChunkedUploadNotStarted, uploadStatusError("unable to start upload", resp))
+	}
+
+	var s struct {
+		UploadID  string `json:"uploadID"`
+		ChunkSize int64  `json:"chunkSize"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return fmt.Errorf("failed to decode response %v", err)
+	}
+	u.session = uploadSession{
+		UploadID:  s.UploadID,
+		ServerURL: u.c.ServerURL.String(),
+		SHA256:    u.digest,
+		Size:      u.size,
+		ChunkSize: int64(u.c.ChunkSizeMB) * 1024 * 1024,
+	}
+	if s.ChunkSize > 0 {
+		u.session.ChunkSize = s.ChunkSize
+	}
+	log.Debug().Str("Upload ID", s.UploadID).Int64("Chunk size", u.session.ChunkSize).Msg("Started upload")
+	return u.save()
+}
+
+// sendChunk sends the chunk at the session's offset, retrying it, and records how far the upload has got
+func (u *chunkedUploader) sendChunk(f *os.File) error {
+	delay := chunkRetryDelay
+	for attempt := 0; ; attempt++ {
+		start := u.session.Offset
+		end := start + u.session.ChunkSize
+		if end > u.size {
+			end = u.size
+		}
+		u.progress.Set(start)
+		body := u.progress.Reader(io.NewSectionReader(f, start, end-start))
+		header := http.Header{}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, u.size))
+		header.Set("Content-Type", "application/octet-stream")
+
+		offset, err := u.put(body, end-start, header)
+		if err == nil && offset == start {
+			err = fmt.Errorf("the upload service did not accept the chunk at %s", formatBytes(start))
+		}
+		if err == nil {
+			u.session.Offset = offset
+			return u.save()
+		}
+		if errors.Is(err, errUploadSessionGone) || errors.Is(err, errChunkRejected) || attempt >= u.c.ChunkRetries {
+			return err
+		}
+		log.Warn().Err(err).Int("Attempt", attempt+1).Dur("Retrying in", delay).Msg(fmt.Sprintf("Failed to upload chunk at %s", formatBytes(start)))
+		time.Sleep(delay)
+		delay *= 2
+		if delay > chunkMaxRetryDelay {
+			delay = chunkMaxRetryDelay
+		}
+
+		// the chunk may have partly arrived, so carry on from wherever the service got to
+		if offset, err := u.offset(); err == nil {
+			u.session.Offset = offset
+		} else if errors.Is(err, errUploadSessionGone) {
+			return err
+		}
+	}
+}
+
+// put sends a chunk, returning the offset the service has received up to
+func (u *chunkedUploader) put(body io.Reader, length int64, header http.Header) (offset int64, err error) {
+	resp, err := u.doLength(http.MethodPut, "/sessions/"+u.session.UploadID, body, length, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusConflict:
+		// a conflict means the service expected a different offset, which it tells us
+		return decodeUploadOffset(resp)
+	case http.StatusNotFound:
+		return 0, errUploadSessionGone
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return 0, uploadStatusError("chunk upload failed", resp)
+	}
+	if resp.StatusCode < 500 {
+		return 0, fmt.Errorf("%w: %s", errChunkRejected, uploadStatusError("chunk upload failed", resp))
+	}
+	return 0, uploadStatusError("chunk upload failed", resp)
+}
+
+// offset asks the service how much of the upload it has received
+func (u *chunkedUploader) offset() (int64, error) {
+	resp, err := u.do(http.MethodGet, "/sessions/"+u.session.UploadID, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return decodeUploadOffset(resp)
+	case http.StatusNotFound:
+		return 0, errUploadSessionGone
+	default:
+		return 0, uploadStatusError("unable to check upload", resp)
+	}
+}
+
+// complete finishes the upload, returning the payload it was stored as
+func (u *chunkedUploader) complete() (response UploadResponse, err error) {
+	resp, err := u.do(http.MethodPost, "/sessions/"+u.session.UploadID+"/complete", nil, nil)
+	if err != nil {
+		return response, fmt.Errorf("unable to complete upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return response, uploadStatusError("unable to complete upload", resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return response, fmt.Errorf("failed to decode response %v", err)
+	}
+	return response, nil
+}
+
+func (u *chunkedUploader) save() error {
+	b, err := json.Marshal(u.session)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(u.statePath(), b, 0600)
+}
+
+func (u *chunkedUploader) do(method string, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	return u.doLength(method, path, body, -1, header)
+}
+
+func (u *chunkedUploader) doLength(method string, path string, body io.Reader, length int64, header http.Header) (*http.Response, error) {
+	target := *u.c.ServerURL
+	target.Path = strings.TrimSuffix(target.Path, "/") + path
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if length >= 0 {
+		req.ContentLength = length
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Add("section-token", api.Token)
+	log.Debug().Str("Request Method", method).Str("Request URL", target.String()).Msg("Upload request")
+	return u.client.Do(req)
+}
+
+func decodeUploadOffset(resp *http.Response) (int64, error) {
+	var o struct {
+		Offset int64 `json:"offset"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return 0, fmt.Errorf("failed to decode response %v", err)
+	}
+	return o.Offset, nil
+}
+
+func uploadStatusError(msg string, resp *http.Response) error {
+	return fmt.Errorf("%s with status: %s and transaction ID %s", msg, resp.Status, resp.Header.Get("Aperture-Tx-Id"))
+}
@@ -0,0 +1,254 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUploadService stands in for the upload service, implementing both single request and chunked uploads
+type fakeUploadService struct {
+	mu sync.Mutex
+	// chunkSize is returned when an upload starts
+	chunkSize int64
+	// chunked is false to refuse chunked uploads
+	chunked bool
+	// startStatus, if set, is returned instead of starting an upload
+	startStatus int
+	// failPuts makes chunks fail after storing half of them, as if the connection dropped,
+	// once okPuts chunks have been accepted
+	failPuts int
+	okPuts   int
+
+	sessions map[string]*bytes.Buffer
+	digests  map[string]string
+	starts   int
+	single   []byte
+	uploaded []byte
+	digest   string
+}
+
+func newFakeUploadService(chunkSize int64) *fakeUploadService {
+	return &fakeUploadService{chunkSize: chunkSize, chunked: true, sessions: map[string]*bytes.Buffer{}, digests: map[string]string{}}
+}
+
+func (s *fakeUploadService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("section-token") == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodPost:
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.single, _ = ioutil.ReadAll(file)
+		s.digest = r.FormValue("sha256")
+		fmt.Fprint(w, `{"payloadID": "single"}`)
+	case !s.chunked:
+		w.WriteHeader(http.StatusNotFound)
+	case len(parts) == 1 && parts[0] == "sessions" && r.Method == http.MethodPost && s.startStatus != 0:
+		w.WriteHeader(s.startStatus)
+	case len(parts) == 1 && parts[0] == "sessions" && r.Method == http.MethodPost:
+		var body struct {
+			SHA256 string `json:"sha256"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.starts++
+		id := fmt.Sprintf("upload-%d", s.starts)
+		s.sessions[id] = &bytes.Buffer{}
+		s.digests[id] = body.SHA256
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"uploadID": %q, "chunkSize": %d}`, id, s.chunkSize)
+	case len(parts) >= 2 && parts[0] == "sessions":
+		data, ok := s.sessions[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case len(parts) == 3 && parts[2] == "complete" && r.Method == http.MethodPost:
+			s.uploaded = data.Bytes()
+			s.digest = s.digests[parts[1]]
+			fmt.Fprintf(w, `{"payloadID": %q}`, parts[1])
+		case r.Method == http.MethodGet:
+			fmt.Fprintf(w, `{"offset": %d}`, data.Len())
+		case r.Method == http.MethodPut:
+			var start, end, total int64
+			fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+			if start != int64(data.Len()) {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprintf(w, `{"offset": %d}`, data.Len())
+				return
+			}
+			chunk, _ := ioutil.ReadAll(r.Body)
+			if s.okPuts > 0 {
+				s.okPuts--
+			} else if s.failPuts > 0 {
+				s.failPuts--
+				data.Write(chunk[:len(chunk)/2])
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			data.Write(chunk)
+			fmt.Fprintf(w, `{"offset": %d}`, data.Len())
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func helperUploadTarball(t *testing.T, size int) (path string, contents []byte) {
+	contents = make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(contents)
+	path = filepath.Join(t.TempDir(), "sectionctl-deploy.test.tar.gz")
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	chunkRetryDelay = time.Millisecond
+	t.Cleanup(func() { chunkRetryDelay = 1 * time.Second })
+	return path, contents
+}
+
+func helperUploadCmd(t *testing.T, service *fakeUploadService) (*DeployCmd, *ProgressBar) {
+	ts := httptest.NewServer(service)
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &DeployCmd{AccountID: 1, AppID: 2, ServerURL: u, Timeout: 5 * time.Second, UploadMode: uploadModeAuto, ChunkSizeMB: 1, ChunkRetries: 3}
+	logWriters := LogWriters{ConsoleWriter: io.Discard, FileWriter: io.Discard, ConsoleOnly: io.Discard, CarriageReturnWriter: io.Discard}
+	return c, NewProgressBar("Uploading app", 0, &CLI{}, &logWriters)
+}
+
+func TestCommandsUploadChunkedRetriesFailedChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path, contents := helperUploadTarball(t, 2*1024*1024+100)
+	service := newFakeUploadService(512 * 1024)
+	service.failPuts = 2
+	c, progress := helperUploadCmd(t, service)
+
+	// Invoke
+	response, err := c.upload(path, int64(len(contents)), "abc123", progress)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("upload-1", response.PayloadID)
+	assert.Equal(1, service.starts)
+	assert.Equal(contents, service.uploaded)
+	assert.Equal("abc123", service.digest)
+	_, err = os.Stat(path + ".upload.json")
+	assert.True(os.IsNotExist(err), "upload state is removed once the upload completes")
+}
+
+func TestCommandsUploadChunkedResumesInterruptedUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path, contents := helperUploadTarball(t, 2*1024*1024)
+	service := newFakeUploadService(512 * 1024)
+	service.okPuts = 2
+	service.failPuts = 1
+	c, progress := helperUploadCmd(t, service)
+	c.ChunkRetries = 0
+	_, firstErr := c.upload(path, int64(len(contents)), "abc123", progress)
+	state, stateErr := ioutil.ReadFile(path + ".upload.json")
+
+	// Invoke
+	c.ChunkRetries = 3
+	response, err := c.upload(path, int64(len(contents)), "abc123", progress)
+
+	// Test
+	assert.Error(firstErr)
+	assert.NoError(stateErr)
+	assert.Contains(string(state), `"offset":1048576`)
+	assert.NoError(err)
+	assert.Equal("upload-1", response.PayloadID)
+	assert.Equal(1, service.starts, "the interrupted upload is resumed rather than started again")
+	assert.Equal(contents, service.uploaded)
+}
+
+func TestCommandsUploadFallsBackToSingleRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path, contents := helperUploadTarball(t, 1024*1024+1)
+	service := newFakeUploadService(512 * 1024)
+	service.chunked = false
+	c, progress := helperUploadCmd(t, service)
+
+	// Invoke
+	response, err := c.upload(path, int64(len(contents)), "abc123", progress)
+	c.UploadMode = uploadModeChunked
+	_, chunkedErr := c.upload(path, int64(len(contents)), "abc123", progress)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("single", response.PayloadID)
+	assert.Equal(contents, service.single)
+	assert.Equal("abc123", service.digest)
+	assert.ErrorIs(chunkedErr, errChunkedUploadNotStarted)
+}
+
+func TestCommandsUploadFallsBackWhenUploadCannotStart(t *testing.T) {
+	var testCases = []int{http.StatusNotFound, http.StatusForbidden, http.StatusInternalServerError}
+
+	for _, status := range testCases {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			assert := assert.New(t)
+
+			// Setup
+			path, contents := helperUploadTarball(t, 1024*1024+1)
+			service := newFakeUploadService(512 * 1024)
+			service.startStatus = status
+			c, progress := helperUploadCmd(t, service)
+
+			// Invoke
+			response, err := c.upload(path, int64(len(contents)), "abc123", progress)
+
+			// Test
+			assert.NoError(err)
+			assert.Equal("single", response.PayloadID)
+			assert.Equal(contents, service.single)
+		})
+	}
+}
+
+func TestCommandsUploadSmallTarballsUseSingleRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path, contents := helperUploadTarball(t, 1000)
+	service := newFakeUploadService(512 * 1024)
+	c, progress := helperUploadCmd(t, service)
+
+	// Invoke
+	response, err := c.upload(path, int64(len(contents)), "abc123", progress)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("single", response.PayloadID)
+	assert.Equal(0, service.starts)
+}
@@ -31,6 +31,10 @@ func (c *WhoAmICmd) Run(cli *CLI, logWriters *LogWriters) (err error) {
 		return err
 	}
 
+	if ok, err := WriteStructured(cli, os.Stdout, u); ok {
+		return err
+	}
+
 	table := NewTable(cli, os.Stdout)
 	table.SetHeader([]string{"Attribute", "Value"})
 	r := [][]string{
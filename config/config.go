@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PathEnv is the environment variable that overrides the location of the config file
+const PathEnv = "SECTIONCTL_CONFIG"
+
+// ErrProfileNotFound is returned when a named profile does not exist in the config
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile holds the settings for working against one Section endpoint and account
+type Profile struct {
+	APIPrefix       string        `yaml:"api_prefix,omitempty"`
+	APITimeout      time.Duration `yaml:"api_timeout,omitempty"`
+	AccountID       int           `yaml:"account_id,omitempty"`
+	AppID           int           `yaml:"app_id,omitempty"`
+	Environment     string        `yaml:"environment,omitempty"`
+	KeyringKey      string        `yaml:"keyring_key,omitempty"`
+	CredentialStore string        `yaml:"credential_store,omitempty"`
+}
+
+// Config is the sectionctl configuration file
+type Config struct {
+	CurrentProfile string             `yaml:"current_profile,omitempty"`
+	Profiles       map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Path returns the location of the config file, ~/.config/sectionctl/config on Linux,
+// unless overridden with SECTIONCTL_CONFIG.
+func Path() (string, error) {
+	if p := os.Getenv(PathEnv); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return filepath.Join(dir, "sectionctl", "config"), nil
+}
+
+// Load reads the config file at path. A missing file results in an empty config.
+func Load(path string) (c Config, err error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("unable to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("unable to parse config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the config to path, creating its directory if needed.
+//
+// The file is only readable by the current user, as later settings may be sensitive.
+func (c *Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create config directory: %w", err)
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// Profile returns the named profile
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return p, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return p, nil
+}
+
+// SetProfile adds or replaces the named profile
+func (c *Config) SetProfile(name string, p Profile) {
+	if c.Profiles == nil {
+		c.Profiles = map[string]Profile{}
+	}
+	c.Profiles[name] = p
+}
+
+// RemoveProfile deletes the named profile, and stops using it if it is the current profile
+func (c *Config) RemoveProfile(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	delete(c.Profiles, name)
+	if c.CurrentProfile == name {
+		c.CurrentProfile = ""
+	}
+	return nil
+}
+
+// UseProfile makes the named profile the current profile
+func (c *Config) UseProfile(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	c.CurrentProfile = name
+	return nil
+}
+
+// ProfileNames returns the names of all profiles, sorted
+func (c *Config) ProfileNames() (names []string) {
+	for n := range c.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLoadMissingFileIsEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	// Invoke
+	c, err := Load(filepath.Join(t.TempDir(), "config"))
+
+	// Test
+	assert.NoError(err)
+	assert.Empty(c.CurrentProfile)
+	assert.Empty(c.Profiles)
+}
+
+func TestConfigSaveAndLoadRoundTrips(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := filepath.Join(t.TempDir(), "sectionctl", "config")
+	var c Config
+	c.SetProfile("staging", Profile{
+		APIPrefix:   "https://staging.example.com",
+		APITimeout:  45 * time.Second,
+		AccountID:   1,
+		AppID:       2,
+		Environment: "Development",
+		KeyringKey:  "staging",
+	})
+	assert.NoError(c.UseProfile("staging"))
+
+	// Invoke
+	err := c.Save(path)
+	assert.NoError(err)
+	loaded, err := Load(path)
+
+	// Test
+	assert.NoError(err)
+	assert.Equal(c, loaded)
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestConfigRemoveProfileClearsCurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	var c Config
+	c.SetProfile("a", Profile{})
+	c.SetProfile("b", Profile{})
+	assert.NoError(c.UseProfile("a"))
+
+	// Invoke
+	err := c.RemoveProfile("a")
+
+	// Test
+	assert.NoError(err)
+	assert.Empty(c.CurrentProfile)
+	assert.Equal([]string{"b"}, c.ProfileNames())
+	assert.True(errors.Is(c.RemoveProfile("a"), ErrProfileNotFound))
+	assert.True(errors.Is(c.UseProfile("a"), ErrProfileNotFound))
+}
@@ -2,6 +2,7 @@ package credentials
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -17,14 +18,20 @@ var (
 
 // Setup ensures authentication is set up
 func Setup(endpoint string) (token string, err error) {
-	if !IsCredentialRecorded(KeyringService, endpoint) {
-		fmt.Printf("No API credentials recorded.\n\n")
-		fmt.Printf("Let's get you authenticated to the Section API!\n\n")
-
-		_, err := PromptAndWrite(os.Stdin, os.Stdout, endpoint)
-		if err != nil {
-			return token, err
-		}
+	token, err = Read(endpoint)
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return token, err
+	}
+
+	fmt.Printf("No API credentials recorded.\n\n")
+	fmt.Printf("Let's get you authenticated to the Section API!\n\n")
+
+	_, err = PromptAndWrite(os.Stdin, os.Stdout, endpoint)
+	if err != nil {
+		return token, err
 	}
 
 	return Read(endpoint)
@@ -72,15 +79,15 @@ func Prompt(in io.Reader, out io.Writer) (token string, err error) {
 
 // Write saves Section API credentials to a persistent store
 func Write(endpoint, token string) error {
-	return keyring.Set(KeyringService, endpoint, token)
+	return DefaultStore.Write(endpoint, token)
 }
 
 // Read returns a token for authenticating to the Section API
 func Read(endpoint string) (string, error) {
-	return keyring.Get(KeyringService, endpoint)
+	return DefaultStore.Read(endpoint)
 }
 
 // Delete deletes a previously stored credential for the Section API
 func Delete(endpoint string) error {
-	return keyring.Delete(KeyringService, endpoint)
+	return DefaultStore.Delete(endpoint)
 }
@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv is the environment variable holding the passphrase for the file store
+const PassphraseEnv = "SECTION_CREDENTIAL_PASSPHRASE"
+
+// FileStore keeps credentials in a file encrypted with AES-GCM, readable only by the current user.
+//
+// The key is derived from Passphrase, or when that is empty, from the machine and user IDs.
+// A machine key keeps the file from being useful if copied elsewhere, but does not protect
+// it from other processes running as the same user on the same machine.
+//
+// A file that can't be decrypted, say after the passphrase or machine ID changed, is treated
+// as holding no credentials, so logging in again replaces it.
+type FileStore struct {
+	Path       string
+	Passphrase string
+}
+
+// encryptedFile is the on-disk format of the file store
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// NewFileStore returns a file store at ~/.config/sectionctl/credentials on Linux, using the
+// passphrase from SECTION_CREDENTIAL_PASSPHRASE if set.
+func NewFileStore() (FileStore, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return FileStore{}, fmt.Errorf("unable to find config directory: %w", err)
+	}
+	return FileStore{
+		Path:       filepath.Join(dir, "sectionctl", "credentials"),
+		Passphrase: os.Getenv(PassphraseEnv),
+	}, nil
+}
+
+// Name identifies the store
+func (s FileStore) Name() string { return "file" }
+
+// Read returns the credential for endpoint
+func (s FileStore) Read(endpoint string) (string, error) {
+	tokens, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[endpoint]
+	if !ok || token == "" {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+// Write saves the credential for endpoint
+func (s FileStore) Write(endpoint, token string) error {
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	tokens[endpoint] = token
+	return s.save(tokens)
+}
+
+// Delete removes the credential for endpoint
+func (s FileStore) Delete(endpoint string) error {
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[endpoint]; !ok {
+		return ErrNotFound
+	}
+	delete(tokens, endpoint)
+	if len(tokens) == 0 {
+		return os.Remove(s.Path)
+	}
+	return s.save(tokens)
+}
+
+func (s FileStore) load() (map[string]string, error) {
+	tokens := map[string]string{}
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", s.Path, err)
+	}
+	var f encryptedFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", s.Path, err)
+	}
+	gcm, err := s.cipher(f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		log.Warn().Err(err).Str("Path", s.Path).Msg(fmt.Sprintf("Unable to decrypt the credentials file, so ignoring it. Check %s, or log in again to replace it.", PassphraseEnv))
+		return tokens, nil
+	}
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", s.Path, err)
+	}
+	return tokens, nil
+}
+
+func (s FileStore) save(tokens map[string]string) error {
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	f := encryptedFile{Version: 1, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, f.Salt); err != nil {
+		return err
+	}
+	gcm, err := s.cipher(f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("unable to create credentials directory: %w", err)
+	}
+	// write then rename, so an interrupted write can't lose existing credentials
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+func (s FileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	secret := s.Passphrase
+	if secret == "" {
+		secret = machineSecret()
+	}
+	key, err := scrypt.Key([]byte(secret), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// machineSecret returns a value unique to this machine and user
+func machineSecret() string {
+	parts := []string{"sectionctl"}
+	for _, p := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := os.ReadFile(p); err == nil {
+			parts = append(parts, strings.TrimSpace(string(b)))
+			break
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		parts = append(parts, u.Uid, u.Username)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return fmt.Sprintf("%x", sum)
+}
@@ -0,0 +1,185 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+var (
+	// ErrNotFound is returned when a store holds no credential for an endpoint
+	ErrNotFound = errors.New("credential not found")
+	// ErrReadOnly is returned when writing to a store that can't save credentials
+	ErrReadOnly = errors.New("credential store is read-only")
+	// ErrNoEnvToken is returned by the env store when SECTION_TOKEN is not set
+	ErrNoEnvToken = errors.New("SECTION_TOKEN is not set, and the env credential store does not save tokens")
+
+	// DefaultStore is the store used by Setup, Write, Read and Delete
+	DefaultStore Store = KeyringStore{Service: KeyringService}
+)
+
+// Store persists credentials for the Section API, one per endpoint
+type Store interface {
+	// Name identifies the store in messages, and for selecting it with NewStore
+	Name() string
+	Read(endpoint string) (token string, err error)
+	Write(endpoint, token string) error
+	Delete(endpoint string) error
+}
+
+// NewStore returns the store with the given name: keyring, file, env, or auto.
+//
+// auto uses the system keyring, falling back to the encrypted file store where no
+// keyring is available, such as on headless Linux.
+func NewStore(name string) (Store, error) {
+	switch name {
+	case "keyring":
+		return KeyringStore{Service: KeyringService}, nil
+	case "file":
+		return NewFileStore()
+	case "env":
+		return EnvStore{}, nil
+	case "auto", "":
+		fs, err := NewFileStore()
+		if err != nil {
+			return nil, err
+		}
+		return FallbackStore{KeyringStore{Service: KeyringService}, fs}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential store: %s", name)
+	}
+}
+
+// KeyringStore keeps credentials in the operating system's keyring
+type KeyringStore struct {
+	Service string
+}
+
+// Name identifies the store
+func (s KeyringStore) Name() string { return "keyring" }
+
+// Read returns the credential for endpoint
+func (s KeyringStore) Read(endpoint string) (string, error) {
+	token, err := keyring.Get(s.Service, endpoint)
+	if errors.Is(err, keyring.ErrNotFound) || (err == nil && token == "") {
+		return "", ErrNotFound
+	}
+	return token, err
+}
+
+// Write saves the credential for endpoint
+func (s KeyringStore) Write(endpoint, token string) error {
+	return keyring.Set(s.Service, endpoint, token)
+}
+
+// Delete removes the credential for endpoint
+func (s KeyringStore) Delete(endpoint string) error {
+	err := keyring.Delete(s.Service, endpoint)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// EnvStore only reads the token from the SECTION_TOKEN environment variable, and never saves it
+type EnvStore struct{}
+
+// Name identifies the store
+func (EnvStore) Name() string { return "env" }
+
+// Read returns the value of SECTION_TOKEN, whatever the endpoint
+func (EnvStore) Read(endpoint string) (string, error) {
+	if t := os.Getenv("SECTION_TOKEN"); t != "" {
+		return t, nil
+	}
+	return "", ErrNoEnvToken
+}
+
+// Write always fails, as the environment can't be changed for later commands
+func (EnvStore) Write(endpoint, token string) error {
+	return fmt.Errorf("%w: set SECTION_TOKEN instead", ErrReadOnly)
+}
+
+// Delete does nothing, as there is nothing stored
+func (EnvStore) Delete(endpoint string) error {
+	return nil
+}
+
+// FallbackStore tries each of its stores in turn
+type FallbackStore []Store
+
+// Name identifies the store
+func (f FallbackStore) Name() string {
+	var names []string
+	for _, s := range f {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// Read returns the credential from the first store that holds one
+func (f FallbackStore) Read(endpoint string) (string, error) {
+	var errs []string
+	var missing bool
+	for _, s := range f {
+		token, err := s.Read(endpoint)
+		if err == nil {
+			return token, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			missing = true
+			continue
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", s.Name(), err))
+	}
+	if missing || len(errs) == 0 {
+		return "", ErrNotFound
+	}
+	return "", fmt.Errorf("unable to read credential: %s", strings.Join(errs, "; "))
+}
+
+// Write saves the credential in the first store that accepts it
+func (f FallbackStore) Write(endpoint, token string) error {
+	_, err := f.WriteTo(endpoint, token)
+	return err
+}
+
+// WriteTo saves the credential in the first store that accepts it, returning that store
+func (f FallbackStore) WriteTo(endpoint, token string) (Store, error) {
+	var errs []string
+	for _, s := range f {
+		err := s.Write(endpoint, token)
+		if err == nil {
+			return s, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", s.Name(), err))
+	}
+	return nil, fmt.Errorf("unable to write credential: %s", strings.Join(errs, "; "))
+}
+
+// Delete removes the credential from every store that holds one
+func (f FallbackStore) Delete(endpoint string) error {
+	var errs []string
+	var deleted, missing bool
+	for _, s := range f {
+		err := s.Delete(endpoint)
+		switch {
+		case err == nil:
+			deleted = true
+		case errors.Is(err, ErrNotFound):
+			missing = true
+		default:
+			errs = append(errs, fmt.Sprintf("%s: %s", s.Name(), err))
+		}
+	}
+	if deleted {
+		return nil
+	}
+	if missing || len(errs) == 0 {
+		return ErrNotFound
+	}
+	return fmt.Errorf("unable to delete credential: %s", strings.Join(errs, "; "))
+}
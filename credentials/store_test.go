@@ -0,0 +1,162 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando/go-keyring"
+)
+
+// brokenStore fails like a keyring on a machine without a Secret Service
+type brokenStore struct{}
+
+func (brokenStore) Name() string                         { return "broken" }
+func (brokenStore) Read(endpoint string) (string, error) { return "", errors.New("no keyring") }
+func (brokenStore) Write(endpoint, token string) error   { return errors.New("no keyring") }
+func (brokenStore) Delete(endpoint string) error         { return errors.New("no keyring") }
+
+func TestCredentialsFileStoreRoundTrips(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := filepath.Join(t.TempDir(), "sectionctl", "credentials")
+	s := FileStore{Path: path, Passphrase: "hunter2"}
+
+	// Invoke
+	assert.NoError(s.Write("aperture.section.io", "s3cr3t"))
+	assert.NoError(s.Write("staging.example.com", "0th3r"))
+	token, err := s.Read("aperture.section.io")
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("s3cr3t", token)
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	b, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.NotContains(string(b), "s3cr3t")
+
+	_, err = FileStore{Path: path, Passphrase: "wrong"}.Read("aperture.section.io")
+	assert.True(errors.Is(err, ErrNotFound))
+
+	assert.NoError(s.Delete("aperture.section.io"))
+	_, err = s.Read("aperture.section.io")
+	assert.True(errors.Is(err, ErrNotFound))
+	token, err = s.Read("staging.example.com")
+	assert.NoError(err)
+	assert.Equal("0th3r", token)
+}
+
+func TestCredentialsFileStoreUsesMachineKeyWithoutPassphrase(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	s := FileStore{Path: filepath.Join(t.TempDir(), "credentials")}
+
+	// Invoke
+	err := s.Write("aperture.section.io", "s3cr3t")
+	token, err2 := s.Read("aperture.section.io")
+
+	// Test
+	assert.NoError(err)
+	assert.NoError(err2)
+	assert.Equal("s3cr3t", token)
+}
+
+func TestCredentialsFileStoreReplacesFileItCannotDecrypt(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	path := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(FileStore{Path: path, Passphrase: "old"}.Write("aperture.section.io", "s3cr3t"))
+	s := FileStore{Path: path, Passphrase: "new"}
+
+	// Invoke
+	_, readErr := s.Read("aperture.section.io")
+	writeErr := s.Write("aperture.section.io", "n3w")
+	token, err := s.Read("aperture.section.io")
+
+	// Test
+	assert.True(errors.Is(readErr, ErrNotFound))
+	assert.NoError(writeErr)
+	assert.NoError(err)
+	assert.Equal("n3w", token)
+}
+
+func TestCredentialsFallbackStoreFallsBackWhenKeyringUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	fs := FileStore{Path: filepath.Join(t.TempDir(), "credentials"), Passphrase: "hunter2"}
+	s := FallbackStore{brokenStore{}, fs}
+
+	// Invoke
+	_, err := s.Read("aperture.section.io")
+	assert.True(errors.Is(err, ErrNotFound))
+	written, err := s.WriteTo("aperture.section.io", "s3cr3t")
+	assert.NoError(err)
+	token, err := s.Read("aperture.section.io")
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("s3cr3t", token)
+	assert.Equal("file", written.Name())
+	assert.NoError(s.Delete("aperture.section.io"))
+	assert.True(errors.Is(s.Delete("aperture.section.io"), ErrNotFound))
+}
+
+func TestCredentialsFallbackStoreDeletesFromEveryStore(t *testing.T) {
+	assert := assert.New(t)
+	keyring.MockInit()
+
+	// Setup
+	ks := KeyringStore{Service: KeyringService}
+	fs := FileStore{Path: filepath.Join(t.TempDir(), "credentials"), Passphrase: "hunter2"}
+	assert.NoError(ks.Write(t.Name(), "s3cr3t"))
+	assert.NoError(fs.Write(t.Name(), "0ld"))
+
+	// Invoke
+	err := FallbackStore{ks, fs}.Delete(t.Name())
+
+	// Test
+	assert.NoError(err)
+	_, err = ks.Read(t.Name())
+	assert.True(errors.Is(err, ErrNotFound))
+	_, err = fs.Read(t.Name())
+	assert.True(errors.Is(err, ErrNotFound))
+}
+
+func TestCredentialsEnvStoreOnlyReadsEnvironment(t *testing.T) {
+	assert := assert.New(t)
+
+	// Setup
+	os.Setenv("SECTION_TOKEN", "s3cr3t")
+	defer os.Unsetenv("SECTION_TOKEN")
+	s := EnvStore{}
+
+	// Invoke
+	token, err := s.Read("aperture.section.io")
+
+	// Test
+	assert.NoError(err)
+	assert.Equal("s3cr3t", token)
+	assert.True(errors.Is(s.Write("aperture.section.io", "0th3r"), ErrReadOnly))
+	os.Unsetenv("SECTION_TOKEN")
+	_, err = s.Read("aperture.section.io")
+	assert.True(errors.Is(err, ErrNoEnvToken))
+}
+
+func TestCredentialsNewStoreRejectsUnknownStore(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewStore("vault")
+	assert.Error(err)
+
+	s, err := NewStore("auto")
+	assert.NoError(err)
+	assert.Equal("keyring,file", s.Name())
+}
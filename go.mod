@@ -6,6 +6,7 @@ require (
 	github.com/alecthomas/kong v0.2.16
 	github.com/briandowns/spinner v1.15.0
 	github.com/fatih/color v1.12.0
+	github.com/go-git/go-billy/v5 v5.1.0
 	github.com/go-git/go-git/v5 v5.3.0
 	github.com/hashicorp/go-version v1.2.1
 	github.com/logrusorgru/aurora v2.0.3+incompatible
@@ -13,10 +14,13 @@ require (
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/posener/complete v1.2.3
 	github.com/rs/zerolog v1.22.0
+	github.com/sergi/go-diff v1.1.0
 	github.com/stretchr/testify v1.7.0
 	github.com/tc-hib/go-winres v0.2.0 // indirect
 	github.com/willabides/kongplete v0.2.0
 	github.com/zalando/go-keyring v0.1.1
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
+	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	golang.org/x/sys v0.0.0-20210601080250-7ecdf8ef093b // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -6,6 +6,7 @@ import (
 	golog "log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -15,17 +16,23 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/section/sectionctl/api"
 	"github.com/section/sectionctl/commands"
+	"github.com/section/sectionctl/config"
 	"github.com/section/sectionctl/credentials"
 	"github.com/willabides/kongplete"
 )
 
 //go:generate go-winres make --product-version=git-tag --file-version=git-tag
-func bootstrap(c *commands.CLI, cmd *kong.Context) {
+func bootstrap(c *commands.CLI, cmd *kong.Context, cfg config.Config) {
 
 	api.PrefixURI = c.SectionAPIPrefix
 	api.Timeout = c.SectionAPITimeout
+	api.MaxAttempts = c.SectionAPIRetries
 	ctx := cmd
 	colorableWriter := colorable.NewColorableStdout()
+	if c.IsStructuredOutput() {
+		// keep stdout clean for machine-readable output
+		colorableWriter = colorable.NewColorableStderr()
+	}
 	consoleWriter := zerolog.ConsoleWriter{Out: colorableWriter, PartsExclude: []string{zerolog.TimestampFieldName,zerolog.LevelFieldName}}
 	fileOutput := io.Discard
 	multi := zerolog.MultiLevelWriter(consoleWriter)
@@ -42,6 +49,7 @@ func bootstrap(c *commands.CLI, cmd *kong.Context) {
 		fmt.Fprintf(logFile, "Command:   %s\n", ctx.Args)
 		fmt.Fprintf(logFile, "PrefixURI: %s\n", api.PrefixURI)
 		fmt.Fprintf(logFile, "Timeout:   %s\n", api.Timeout)
+		fmt.Fprintf(logFile, "Attempts:  %d\n", api.MaxAttempts)
 		fmt.Printf("Writing debug log to: %s\n", logFilePath)
 		fileOutput = zerolog.New(logFile).With().Timestamp().Logger()
 		if c.Quiet{
@@ -69,17 +77,37 @@ func bootstrap(c *commands.CLI, cmd *kong.Context) {
 	}
 
 	ctx.Bind(&logWriters)
+	if !strings.HasPrefix(cmd.Command(), "profile") {
+		// flags were already filled in from the profile while parsing, make sure it exists
+		name, _, err := commands.ActiveProfile(c.Profile, cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Unable to use profile")
+		}
+		if name != "" {
+			log.Debug().Str("Profile", name).Str("PrefixURI", api.PrefixURI.String()).Msg("Using profile")
+		}
+	}
+	store, err := credentials.NewStore(c.CredentialStore)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to set up credential store")
+	}
+	credentials.DefaultStore = store
 	switch {
 	case cmd.Command() == "version":
 		// bypass auth check for version command
+	case strings.HasPrefix(cmd.Command(), "profile"):
+		// profiles are local, and may be what points us at the right endpoint
+	case cmd.Command() == "deploy package":
+		// packaging is local, the API is only used to detect the kind of app when a token is given
+		api.Token = c.SectionToken
 	case cmd.Command() == "login":
 		api.Token = c.SectionToken
 	case cmd.Command() != "login" && cmd.Command() != "logout":
 		t := c.SectionToken
 		if t == "" {
-			to, err := credentials.Setup(api.PrefixURI.Host)
+			to, err := credentials.Setup(c.TokenKey())
 			if err != nil {
-				log.Fatal().Err(err)
+				log.Fatal().Err(err).Msg("Unable to look up API credentials")
 			}
 			t = to
 
@@ -98,17 +126,30 @@ func main() {
 
 
 	golog.SetFlags(0)
+	cfg, err := loadConfig()
+	if err != nil {
+		golog.Printf("Ignoring sectionctl config: %s", err)
+	}
 	cmd := kong.Parse(&c,
 		kong.Description("CLI to interact with Section."),
 		kong.UsageOnError(),
 		kong.Bind(&c),
+		kong.Resolvers(commands.ProfileResolver(cfg)),
 		kong.Configuration(commands.PackageJSONResolver, "package.json"),
 		kong.ConfigureHelp(kong.HelpOptions{Tree: true}),
 	)
 
-	bootstrap(&c, cmd)
+	bootstrap(&c, cmd, cfg)
 
 	
 	er := cmd.Run()
 	cmd.FatalIfErrorf(er)
 }
+
+func loadConfig() (config.Config, error) {
+	path, err := config.Path()
+	if err != nil {
+		return config.Config{}, err
+	}
+	return config.Load(path)
+}